@@ -32,33 +32,21 @@ func main() {
 		logger.WithError(err).Fatal("kubernetes.NewForConfig failed")
 	}
 
-	podCh := make(chan *corev1.Pod, 5)
-
-	go func() {
-		defer close(podCh)
-		if err := streamlister.StreamList(context.Background(), clientset.CoreV1().RESTClient(), "pods", "", metav1.ListOptions{ResourceVersion: "0"}, streamlister.ParamFuncs{
-			ObjectFactoryFunc: func() runtime.Object {
-				return &corev1.Pod{}
-			},
-			OnListMetaFunc: func(listMeta *metav1.ListMeta) {
-				logger.Infof("rv=%s", listMeta.ResourceVersion)
-			},
-			OnObjectFunc: func(obj runtime.Object) {
-				pod := obj.(*corev1.Pod)
-				podCh <- pod
-			},
-			OnTypeMetaFunc: func(meta *metav1.TypeMeta) {
-				logger.Infof("typeMeta: %+v", meta)
-			},
-		}); err != nil {
-			logger.WithError(err).Fatal("streamlister.StreamList failed")
-		}
-	}()
+	it := streamlister.NewIterator(context.Background(), clientset.CoreV1().RESTClient(), "pods", "", metav1.ListOptions{ResourceVersion: "0"}, func() runtime.Object {
+		return &corev1.Pod{}
+	}, streamlister.WithBufferSize(5), streamlister.WithContentEncodings(streamlister.ContentEncodingGzip))
+	defer it.Close()
 
 	var i int
-	for range podCh {
+	for it.Next() {
+		_ = it.Object().(*corev1.Pod)
 		i++
 	}
+	if err := it.Err(); err != nil {
+		logger.WithError(err).Fatal("streamlister.StreamList failed")
+	}
 
+	logger.Infof("typeMeta: %+v", it.TypeMeta())
+	logger.Infof("rv=%s", it.ListMeta().ResourceVersion)
 	logger.Infof("podList count=%d", i)
 }
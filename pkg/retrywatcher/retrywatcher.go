@@ -25,6 +25,8 @@ import (
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -54,16 +56,19 @@ type RetryWatcher struct {
 	stopChan            chan struct{}
 	doneChan            chan struct{}
 	minRestartDelay     time.Duration
+	tracer              oteltrace.Tracer
+	sessions            int
+	ctx                 context.Context
 }
 
 // NewRetryWatcher creates a new RetryWatcher.
 // It will make sure that watches gets restarted in case of recoverable errors.
 // The initialResourceVersion will be given to watch method when first called.
-func NewRetryWatcher(initialResourceVersion string, watcherClient cache.Watcher) (*RetryWatcher, error) {
-	return newRetryWatcher(initialResourceVersion, watcherClient, 1*time.Second)
+func NewRetryWatcher(initialResourceVersion string, watcherClient cache.Watcher, opts ...Option) (*RetryWatcher, error) {
+	return newRetryWatcher(initialResourceVersion, watcherClient, 1*time.Second, opts...)
 }
 
-func newRetryWatcher(initialResourceVersion string, watcherClient cache.Watcher, minRestartDelay time.Duration) (*RetryWatcher, error) {
+func newRetryWatcher(initialResourceVersion string, watcherClient cache.Watcher, minRestartDelay time.Duration, opts ...Option) (*RetryWatcher, error) {
 	switch initialResourceVersion {
 	case "", "0":
 		// TODO: revisit this if we ever get WATCH v2 where it means start "now"
@@ -80,6 +85,11 @@ func newRetryWatcher(initialResourceVersion string, watcherClient cache.Watcher,
 		doneChan:            make(chan struct{}),
 		resultChan:          make(chan watch.Event, 0),
 		minRestartDelay:     minRestartDelay,
+		tracer:              defaultTracer(),
+		ctx:                 context.Background(),
+	}
+	for _, opt := range opts {
+		opt(rw)
 	}
 
 	go rw.receive()
@@ -99,7 +109,23 @@ func (rw *RetryWatcher) send(event watch.Event) bool {
 
 // doReceive returns true when it is done, false otherwise.
 // If it is not done the second return value holds the time to wait before calling it again.
-func (rw *RetryWatcher) doReceive() (bool, time.Duration) {
+func (rw *RetryWatcher) doReceive(ctx context.Context) (done bool, retryAfter time.Duration) {
+	rw.sessions++
+	_, span := rw.tracer.Start(ctx, "RetryWatcher.watch", oteltrace.WithAttributes(
+		resourceVersionKey.String(rw.lastResourceVersion),
+		sessionKey.Int(rw.sessions),
+	))
+	var events int
+	defer func() {
+		span.SetAttributes(
+			lastResourceVersionKey.String(rw.lastResourceVersion),
+			eventsKey.Int(events),
+			doneKey.Bool(done),
+			retryAfterKey.Float64(retryAfter.Seconds()),
+		)
+		span.End()
+	}()
+
 	watcher, err := rw.watcherClient.Watch(metav1.ListOptions{
 		ResourceVersion:     rw.lastResourceVersion,
 		AllowWatchBookmarks: true,
@@ -120,6 +146,8 @@ func (rw *RetryWatcher) doReceive() (bool, time.Duration) {
 		return false, 0
 
 	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		msg := "Watch failed"
 		if net.IsProbableEOF(err) || net.IsTimeout(err) {
 			klog.V(5).InfoS(msg, "err", err)
@@ -152,15 +180,22 @@ func (rw *RetryWatcher) doReceive() (bool, time.Duration) {
 		case <-rw.stopChan:
 			klog.V(4).InfoS("Stopping RetryWatcher.")
 			return true, 0
+		case <-ctx.Done():
+			klog.V(4).InfoS("Stopping RetryWatcher, context done.")
+			return true, 0
 		case <-idleWatchDetectionTimer.C:
+			span.AddEvent("Idle watch detected")
 			klog.V(4).InfoS("Idle too long not to get an event! Re-creating the watcher.", "resourceVersion", rw.lastResourceVersion)
 			return true, 0
 		case event, ok := <-ch:
 			if !ok {
+				span.AddEvent("Watch closed")
 				klog.V(4).InfoS("Failed to get event! Re-creating the watcher.", "resourceVersion", rw.lastResourceVersion)
 				return false, 0
 			}
 
+			events++
+
 			// We need to inspect the event and get ResourceVersion out of it
 			switch event.Type {
 			case watch.Added, watch.Modified, watch.Deleted, watch.Bookmark:
@@ -211,6 +246,7 @@ func (rw *RetryWatcher) doReceive() (bool, time.Duration) {
 				}
 
 				status := statusErr.ErrStatus
+				span.AddEvent("Watch error", oteltrace.WithAttributes(statusCodeKey.Int(int(status.Code))))
 
 				statusDelay := time.Duration(0)
 				if status.Details != nil {
@@ -261,7 +297,7 @@ func (rw *RetryWatcher) receive() {
 	klog.V(4).Info("Starting RetryWatcher.")
 	defer klog.V(4).Info("Stopping RetryWatcher.")
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(rw.ctx)
 	defer cancel()
 	go func() {
 		select {
@@ -276,7 +312,7 @@ func (rw *RetryWatcher) receive() {
 	// We use non sliding until so we don't introduce delays on happy path when WATCH call
 	// timeouts or gets closed and we need to reestablish it while also avoiding hot loops.
 	wait.NonSlidingUntilWithContext(ctx, func(ctx context.Context) {
-		done, retryAfter := rw.doReceive()
+		done, retryAfter := rw.doReceive(ctx)
 		if done {
 			cancel()
 			return
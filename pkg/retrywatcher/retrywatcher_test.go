@@ -0,0 +1,79 @@
+package watch
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+type fakeWatcher struct{}
+
+func (fakeWatcher) Watch(metav1.ListOptions) (watch.Interface, error) {
+	return watch.NewFake(), nil
+}
+
+// parentRecorder records the parent span of every span started.
+type parentRecorder struct {
+	oteltrace.Tracer
+	mu      sync.Mutex
+	parents []oteltrace.SpanContext
+}
+
+func (r *parentRecorder) Start(ctx context.Context, name string, opts ...oteltrace.SpanStartOption) (context.Context, oteltrace.Span) {
+	r.mu.Lock()
+	r.parents = append(r.parents, oteltrace.SpanContextFromContext(ctx))
+	r.mu.Unlock()
+	return r.Tracer.Start(ctx, name, opts...)
+}
+
+func (r *parentRecorder) sessions() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.parents)
+}
+
+type parentRecorderProvider struct {
+	*parentRecorder
+}
+
+func (p parentRecorderProvider) Tracer(string, ...oteltrace.TracerOption) oteltrace.Tracer {
+	return p.parentRecorder
+}
+
+func TestRetryWatcherWithContext(t *testing.T) {
+	parent := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    oteltrace.TraceID{1},
+		SpanID:     oteltrace.SpanID{2},
+		TraceFlags: oteltrace.FlagsSampled,
+	})
+	ctx, cancel := context.WithCancel(oteltrace.ContextWithSpanContext(context.Background(), parent))
+	recorder := &parentRecorder{Tracer: oteltrace.NewNoopTracerProvider().Tracer("")}
+
+	rw, err := NewRetryWatcher("1", fakeWatcher{}, WithContext(ctx), WithTracerProvider(parentRecorderProvider{recorder}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the first watch session before canceling.
+	for recorder.sessions() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-rw.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("RetryWatcher did not stop after its context was canceled")
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	for _, got := range recorder.parents {
+		if !got.Equal(parent) {
+			t.Errorf("span parent got %v, want %v", got, parent)
+		}
+	}
+}
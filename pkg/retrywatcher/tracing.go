@@ -0,0 +1,42 @@
+package watch
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/ayanamist/k8s-utils/pkg/retrywatcher"
+
+var (
+	resourceVersionKey     = attribute.Key("k8s.resource_version")
+	lastResourceVersionKey = attribute.Key("retrywatcher.last_resource_version")
+	sessionKey             = attribute.Key("retrywatcher.session")
+	eventsKey              = attribute.Key("retrywatcher.events")
+	doneKey                = attribute.Key("retrywatcher.done")
+	retryAfterKey          = attribute.Key("retrywatcher.retry_after_seconds")
+	statusCodeKey          = attribute.Key("k8s.status_code")
+)
+
+type Option func(rw *RetryWatcher)
+
+// WithTracerProvider creates a span for every watch session from the given provider instead of the global one.
+func WithTracerProvider(provider oteltrace.TracerProvider) Option {
+	return func(rw *RetryWatcher) {
+		rw.tracer = provider.Tracer(tracerName)
+	}
+}
+
+// WithContext stops the watcher once ctx is done, and creates the span of every watch session as a child
+// of the span in ctx.
+func WithContext(ctx context.Context) Option {
+	return func(rw *RetryWatcher) {
+		rw.ctx = ctx
+	}
+}
+
+func defaultTracer() oteltrace.Tracer {
+	return otel.GetTracerProvider().Tracer(tracerName)
+}
@@ -0,0 +1,88 @@
+package streamlister
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	ContentEncodingGzip = "gzip"
+	ContentEncodingZstd = "zstd"
+)
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// WithContentEncodings sends Accept-Encoding with the given encodings, and decodes the compressed body on the fly.
+// Without it Go's transport may still negotiate gzip transparently, but the transferred bytes are not visible.
+// Only ContentEncodingGzip and ContentEncodingZstd are supported, others fail the call with ErrInvalidOption.
+func WithContentEncodings(contentEncodings ...string) OptionFunc {
+	return func(options *streamListOptions) {
+		for _, contentEncoding := range contentEncodings {
+			if contentEncoding != ContentEncodingGzip && contentEncoding != ContentEncodingZstd {
+				options.invalid("WithContentEncodings: unsupported content encoding %q", contentEncoding)
+				return
+			}
+		}
+		options.acceptEncodings = contentEncodings
+	}
+}
+
+func (o *streamListOptions) acceptEncodingHeader() string {
+	return strings.Join(o.acceptEncodings, ", ")
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decompress wraps r according to contentEncoding, or the magic bytes of the body if contentEncoding is empty,
+// e.g. behind a proxy dropping the header. Neither magic can start a JSON or protobuf list.
+func decompress(r io.Reader, contentEncoding string) (io.Reader, func(), error) {
+	if contentEncoding == "" {
+		magic := make([]byte, len(zstdMagic))
+		n, err := io.ReadFull(r, magic)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return nil, nil, fmt.Errorf("rc.Read magic: %w", err)
+		}
+		magic = magic[:n]
+		r = io.MultiReader(bytes.NewReader(magic), r)
+		switch {
+		case bytes.HasPrefix(magic, gzipMagic):
+			contentEncoding = ContentEncodingGzip
+		case bytes.HasPrefix(magic, zstdMagic):
+			contentEncoding = ContentEncodingZstd
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		return r, func() {}, nil
+	case ContentEncodingGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("gzip.NewReader: %w", err)
+		}
+		return gr, func() { _ = gr.Close() }, nil
+	case ContentEncodingZstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return nil, nil, fmt.Errorf("zstd.NewReader: %w", err)
+		}
+		return zr, zr.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported Content-Encoding %q", contentEncoding)
+	}
+}
@@ -0,0 +1,108 @@
+package streamlister
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+func compress(t *testing.T, contentEncoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	switch contentEncoding {
+	case ContentEncodingGzip:
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	case ContentEncodingZstd:
+		w, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestStreamListContentEncoding(t *testing.T) {
+	jsonBody, protobufBody := podListBodies(t, 100)
+	bodies := map[string][]byte{runtime.ContentTypeJSON: jsonBody, runtime.ContentTypeProtobuf: protobufBody}
+	for _, contentEncoding := range []string{ContentEncodingGzip, ContentEncodingZstd} {
+		for contentType, body := range bodies {
+			for _, header := range []bool{true, false} {
+				name := fmt.Sprintf("%s/%s/header=%v", contentEncoding, contentType, header)
+				t.Run(name, func(t *testing.T) {
+					compressed := compress(t, contentEncoding, body)
+					var acceptEncoding string
+					srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						acceptEncoding = r.Header.Get("Accept-Encoding")
+						w.Header().Set("Content-Type", contentType)
+						if header {
+							w.Header().Set("Content-Encoding", contentEncoding)
+						}
+						_, _ = w.Write(compressed)
+					}))
+					defer srv.Close()
+					client, err := NewRESTClient(&rest.Config{Host: srv.URL}, schema.GroupVersion{Version: "v1"})
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					var names []string
+					err = StreamListWithError(context.Background(), client, "pods", "", metav1.ListOptions{}, ParamWithErrorFuncs{
+						ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+						OnObjectFunc: func(o runtime.Object) error {
+							names = append(names, o.(*corev1.Pod).Name)
+							return nil
+						},
+					}, WithContentEncodings(ContentEncodingZstd, ContentEncodingGzip))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if acceptEncoding != "zstd, gzip" {
+						t.Errorf("Accept-Encoding got %q", acceptEncoding)
+					}
+					if len(names) != 100 || names[0] != "pod-0" || names[99] != "pod-99" {
+						t.Errorf("got %d items", len(names))
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestStreamListFromReaderCompressed(t *testing.T) {
+	jsonBody, protobufBody := podListBodies(t, 10)
+	for _, contentEncoding := range []string{ContentEncodingGzip, ContentEncodingZstd} {
+		for name, body := range map[string][]byte{"json": jsonBody, "protobuf": protobufBody} {
+			t.Run(contentEncoding+"/"+name, func(t *testing.T) {
+				result, err := streamPodsFromReader(context.Background(), bytes.NewReader(compress(t, contentEncoding, body)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(result.pods) != 10 {
+					t.Errorf("got %d pods", len(result.pods))
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package streamlister
+
+import (
+	"fmt"
+)
+
+// TooManyDecodeErrorsError is returned once more items fail to decode than WithDecodeErrorTolerance allows.
+type TooManyDecodeErrorsError struct {
+	// Errors is the number of items failed to decode, including the last one.
+	Errors int
+	// Index is the position of the last failed item in its response.
+	Index int
+	Err   error
+}
+
+func (e *TooManyDecodeErrorsError) Error() string {
+	return fmt.Sprintf("%d items failed to decode, the last one at index %d: %v", e.Errors, e.Index, e.Err)
+}
+
+func (e *TooManyDecodeErrorsError) Unwrap() error {
+	return e.Err
+}
+
+// WithDecodeErrorTolerance skips items which can not be decoded and passes them to onDecodeError instead of failing,
+// index is the position of the item in its response and raw is only valid during the call. raw holds the item as
+// received, before WithPruneFields removes anything from it. JSON items are read into memory before decoding.
+// The list fails with TooManyDecodeErrorsError once more than maxErrors items are skipped, after onDecodeError
+// is called for the item over the limit, a negative maxErrors means no limit. Errors of the filter of WithFilter
+// are handled the same way.
+func WithDecodeErrorTolerance(maxErrors int, onDecodeError func(index int, raw []byte, err error)) OptionFunc {
+	return func(options *streamListOptions) {
+		options.maxDecodeErrors = maxErrors
+		options.onDecodeError = onDecodeError
+	}
+}
+
+// itemErrorHook counts decode errors of all requests sent by a single StreamList, it returns nil if the
+// tolerance is not enabled.
+func (o *streamListOptions) itemErrorHook() func(index int, raw []byte, err error) error {
+	onDecodeError := o.onDecodeError
+	if onDecodeError == nil {
+		return nil
+	}
+	maxErrors := o.maxDecodeErrors
+	var errs int
+	return func(index int, raw []byte, err error) error {
+		errs++
+		onDecodeError(index, raw, err)
+		if maxErrors >= 0 && errs > maxErrors {
+			return &TooManyDecodeErrorsError{Errors: errs, Index: index, Err: err}
+		}
+		return nil
+	}
+}
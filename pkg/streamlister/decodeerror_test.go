@@ -0,0 +1,183 @@
+package streamlister
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// badProtobufItem claims more ObjectMeta bytes than the item holds.
+var badProtobufItem = []byte{0x0a, 0x05, 0x0a}
+
+// protobufRawPodList encodes a PodList envelope holding the given raw items.
+func protobufRawPodList(t *testing.T, items ...[]byte) []byte {
+	listMeta, err := (&metav1.ListMeta{ResourceVersion: "1"}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	field := func(dAtA []byte, num int, value []byte) []byte {
+		var header [2 * binary.MaxVarintLen64]byte
+		h := binary.PutUvarint(header[:], uint64(num)<<3|2)
+		h += binary.PutUvarint(header[h:], uint64(len(value)))
+		return append(append(dAtA, header[:h]...), value...)
+	}
+	raw := field(nil, 1, listMeta)
+	for _, item := range items {
+		raw = field(raw, 2, item)
+	}
+	unknown := runtime.Unknown{TypeMeta: runtime.TypeMeta{APIVersion: "v1", Kind: "PodList"}, Raw: raw}
+	body, err := unknown.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append([]byte("k8s\x00"), body...)
+}
+
+func marshalPod(t *testing.T, name string) []byte {
+	data, err := (&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+type decodeErrorCall struct {
+	index int
+	raw   []byte
+}
+
+func TestDecodeErrorTolerance(t *testing.T) {
+	bodies := []struct {
+		name        string
+		contentType string
+		body        []byte
+		badRaw      []byte
+	}{
+		{
+			name:        "json",
+			contentType: runtime.ContentTypeJSON,
+			body: []byte(`{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"1"},"items":[` +
+				`{"metadata":{"name":"a"}},{"metadata":{"name":1}},{"metadata":{"name":"c"}},{"metadata":{"name":1}},{"metadata":{"name":"e"}}]}`),
+			badRaw: []byte(`{"metadata":{"name":1}}`),
+		},
+		{
+			name:        "protobuf",
+			contentType: runtime.ContentTypeProtobuf,
+			body:        protobufRawPodList(t, marshalPod(t, "a"), badProtobufItem, marshalPod(t, "c"), badProtobufItem, marshalPod(t, "e")),
+			badRaw:      badProtobufItem,
+		},
+	}
+	tests := []struct {
+		name      string
+		maxErrors int
+		wantNames []string
+		wantCalls []int
+		wantErr   bool
+	}{
+		{name: "unlimited", maxErrors: -1, wantNames: []string{"a", "c", "e"}, wantCalls: []int{1, 3}},
+		{name: "within the limit", maxErrors: 2, wantNames: []string{"a", "c", "e"}, wantCalls: []int{1, 3}},
+		{name: "over the limit", maxErrors: 1, wantNames: []string{"a", "c"}, wantCalls: []int{1, 3}, wantErr: true},
+	}
+	for _, body := range bodies {
+		for _, tt := range tests {
+			t.Run(body.name+"/"+tt.name, func(t *testing.T) {
+				var names []string
+				var calls []decodeErrorCall
+				err := StreamListWithError(context.Background(), fakeClient(body.contentType, body.body), "pods", "", metav1.ListOptions{},
+					podsParam(&names), WithDecodeErrorTolerance(tt.maxErrors, func(index int, raw []byte, err error) {
+						calls = append(calls, decodeErrorCall{index: index, raw: append([]byte(nil), raw...)})
+					}))
+				var tooMany *TooManyDecodeErrorsError
+				if tt.wantErr {
+					if !errors.As(err, &tooMany) {
+						t.Fatalf("got %v, want TooManyDecodeErrorsError", err)
+					}
+					if tooMany.Errors != 2 || tooMany.Index != 3 {
+						t.Errorf("got %d errors at index %d, want 2 at index 3", tooMany.Errors, tooMany.Index)
+					}
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				checkNames(t, names, tt.wantNames)
+				if len(calls) != len(tt.wantCalls) {
+					t.Fatalf("onDecodeError called %d times, want %d", len(calls), len(tt.wantCalls))
+				}
+				for i, call := range calls {
+					if call.index != tt.wantCalls[i] || !bytes.Equal(call.raw, body.badRaw) {
+						t.Errorf("onDecodeError call %d got index %d raw %q", i, call.index, call.raw)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestFilterErrorTolerance(t *testing.T) {
+	bodies := []struct {
+		name        string
+		contentType string
+		body        []byte
+		badRaw      []byte
+		object      func() runtime.Object
+	}{
+		{
+			// The metadata of unstructured items is converted for the filter, which fails on the labels.
+			name:        "json",
+			contentType: runtime.ContentTypeJSON,
+			body: []byte(`{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"1"},"items":[` +
+				`{"kind":"Pod","apiVersion":"v1","metadata":{"name":"a"}},` +
+				`{"kind":"Pod","apiVersion":"v1","metadata":{"name":"b","labels":"x"}},` +
+				`{"kind":"Pod","apiVersion":"v1","metadata":{"name":"c"}}]}`),
+			badRaw: []byte(`{"kind":"Pod","apiVersion":"v1","metadata":{"name":"b","labels":"x"}}`),
+			object: func() runtime.Object { return &unstructured.Unstructured{} },
+		},
+		{
+			// The filter scans the metadata before the item is unmarshalled.
+			name:        "protobuf",
+			contentType: runtime.ContentTypeProtobuf,
+			body:        protobufRawPodList(t, marshalPod(t, "a"), badProtobufItem, marshalPod(t, "c")),
+			badRaw:      badProtobufItem,
+			object:      func() runtime.Object { return &corev1.Pod{} },
+		},
+	}
+	for _, body := range bodies {
+		t.Run(body.name, func(t *testing.T) {
+			var names []string
+			param := ParamWithErrorFuncs{
+				ObjectFactoryFunc: body.object,
+				OnObjectFunc: func(o runtime.Object) error {
+					names = append(names, o.(metav1.Object).GetName())
+					return nil
+				},
+			}
+			filter := WithFilter(func(*FilterItem) bool { return true })
+			client := fakeClient(body.contentType, body.body)
+
+			err := StreamListWithError(context.Background(), client, "pods", "", metav1.ListOptions{}, param, filter)
+			if err == nil {
+				t.Fatal("got no error without WithDecodeErrorTolerance")
+			}
+
+			names = nil
+			var calls []decodeErrorCall
+			err = StreamListWithError(context.Background(), client, "pods", "", metav1.ListOptions{}, param, filter,
+				WithDecodeErrorTolerance(-1, func(index int, raw []byte, err error) {
+					calls = append(calls, decodeErrorCall{index: index, raw: append([]byte(nil), raw...)})
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkNames(t, names, []string{"a", "c"})
+			if len(calls) != 1 || calls[0].index != 1 || !bytes.Equal(calls[0].raw, body.badRaw) {
+				t.Errorf("onDecodeError got %+v", calls)
+			}
+		})
+	}
+}
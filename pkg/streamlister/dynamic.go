@@ -0,0 +1,147 @@
+package streamlister
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// NewRESTClient returns a client for the given group version which can be passed to StreamList.
+func NewRESTClient(config *rest.Config, gv schema.GroupVersion) (rest.Interface, error) {
+	config = rest.CopyConfig(config)
+	config.GroupVersion = &gv
+	if gv.Group == "" {
+		config.APIPath = "/api"
+	} else {
+		config.APIPath = "/apis"
+	}
+	if config.NegotiatedSerializer == nil {
+		config.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
+	}
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	return rest.RESTClientFor(config)
+}
+
+// StreamListDynamic streams any resource, including CRDs, as unstructured objects decoded from JSON.
+// Items without apiVersion or kind get them from the list. Lists encoded with sorted keys carry kind
+// after the items, so from the first item without kind on, items are held back until the list TypeMeta
+// is known. The apiserver sets kind on every item, so this only happens for lists from other sources.
+func StreamListDynamic(ctx context.Context, config *rest.Config, gvr schema.GroupVersionResource, namespace string, listOptions metav1.ListOptions, param TypedParamFuncs[unstructured.Unstructured], opts ...OptionFunc) error {
+	client, err := NewRESTClient(config, gvr.GroupVersion())
+	if err != nil {
+		return fmt.Errorf("NewRESTClient: %w", err)
+	}
+	opts = append([]OptionFunc{
+		WithParameterCodec(metav1.ParameterCodec),
+		WithEncodings(EncodingJSON),
+	}, opts...)
+	return StreamListWithError(ctx, client, gvr.Resource, namespace, listOptions, &unstructuredParam{
+		param:      param,
+		apiVersion: gvr.GroupVersion().String(),
+	}, opts...)
+}
+
+// unstructuredItem is decoded as a plain map, with the same JSON semantics as typed items, and does not
+// require kind to be present like Unstructured.UnmarshalJSON does. OnObject fills the missing TypeMeta.
+type unstructuredItem map[string]interface{}
+
+func (u *unstructuredItem) GetObjectKind() schema.ObjectKind {
+	return &unstructured.Unstructured{Object: u.UnstructuredContent()}
+}
+
+func (u *unstructuredItem) DeepCopyObject() runtime.Object {
+	c := unstructuredItem(runtime.DeepCopyJSON(*u))
+	return &c
+}
+
+func (u *unstructuredItem) NewEmptyInstance() runtime.Unstructured {
+	return &unstructuredItem{}
+}
+
+func (u *unstructuredItem) UnstructuredContent() map[string]interface{} {
+	if *u == nil {
+		*u = unstructuredItem{}
+	}
+	return *u
+}
+
+func (u *unstructuredItem) SetUnstructuredContent(content map[string]interface{}) {
+	*u = content
+}
+
+func (u *unstructuredItem) IsList() bool {
+	return (&unstructured.Unstructured{Object: *u}).IsList()
+}
+
+func (u *unstructuredItem) EachListItem(fn func(runtime.Object) error) error {
+	return (&unstructured.Unstructured{Object: *u}).EachListItem(fn)
+}
+
+type unstructuredParam struct {
+	param      TypedParamFuncs[unstructured.Unstructured]
+	apiVersion string
+	kind       string
+	// typeMetaSeen is false until OnTypeMeta, items are held in pending if kind is still needed.
+	typeMetaSeen bool
+	pending      []*unstructured.Unstructured
+}
+
+func (p *unstructuredParam) ObjectFactory() runtime.Object {
+	return &unstructuredItem{}
+}
+
+func (p *unstructuredParam) OnListMeta(meta *metav1.ListMeta) error {
+	if onListMetaFunc := p.param.OnListMetaFunc; onListMetaFunc != nil {
+		return onListMetaFunc(meta)
+	}
+	return nil
+}
+
+func (p *unstructuredParam) OnTypeMeta(meta *metav1.TypeMeta) error {
+	if meta.APIVersion != "" {
+		p.apiVersion = meta.APIVersion
+	}
+	p.kind = strings.TrimSuffix(meta.Kind, "List")
+	p.typeMetaSeen = true
+	if onTypeMetaFunc := p.param.OnTypeMetaFunc; onTypeMetaFunc != nil {
+		if err := onTypeMetaFunc(meta); err != nil {
+			return err
+		}
+	}
+	pending := p.pending
+	p.pending = nil
+	for _, u := range pending {
+		if err := p.deliver(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *unstructuredParam) OnObject(o runtime.Object) error {
+	u := &unstructured.Unstructured{Object: o.(*unstructuredItem).UnstructuredContent()}
+	if !p.typeMetaSeen && (len(p.pending) > 0 || u.GetKind() == "") {
+		p.pending = append(p.pending, u)
+		return nil
+	}
+	return p.deliver(u)
+}
+
+func (p *unstructuredParam) deliver(u *unstructured.Unstructured) error {
+	if u.GetAPIVersion() == "" {
+		u.SetAPIVersion(p.apiVersion)
+	}
+	if u.GetKind() == "" && p.kind != "" {
+		u.SetKind(p.kind)
+	}
+	return p.param.OnObjectFunc(u)
+}
@@ -0,0 +1,121 @@
+package streamlister
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+func TestStreamListDynamicTypeMeta(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		listKind string
+		kinds    []string
+	}{
+		{
+			name:     "kind first",
+			body:     `{"kind":"PodList","apiVersion":"v1","metadata":{},"items":[{"metadata":{"name":"a"}},{"kind":"Pod","metadata":{"name":"b"}}]}`,
+			listKind: "PodList",
+			kinds:    []string{"Pod", "Pod"},
+		},
+		{
+			name:     "kind after items",
+			body:     `{"apiVersion":"v1","items":[{"metadata":{"name":"a"}},{"kind":"Pod","metadata":{"name":"b"}}],"kind":"PodList","metadata":{}}`,
+			listKind: "PodList",
+			kinds:    []string{"Pod", "Pod"},
+		},
+		{
+			name:  "no kind",
+			body:  `{"apiVersion":"v1","items":[{"metadata":{"name":"a"}},{"kind":"Pod","metadata":{"name":"b"}}],"metadata":{}}`,
+			kinds: []string{"", "Pod"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			var typeMeta metav1.TypeMeta
+			var kinds []string
+			err := StreamListDynamic(context.Background(), &rest.Config{Host: srv.URL}, schema.GroupVersionResource{Version: "v1", Resource: "pods"}, "", metav1.ListOptions{},
+				TypedParamFuncs[unstructured.Unstructured]{
+					OnTypeMetaFunc: func(meta *metav1.TypeMeta) error {
+						if len(kinds) != 0 {
+							t.Errorf("OnTypeMeta called after %d items", len(kinds))
+						}
+						typeMeta = *meta
+						return nil
+					},
+					OnObjectFunc: func(u *unstructured.Unstructured) error {
+						if u.GetAPIVersion() != "v1" {
+							t.Errorf("%s: apiVersion got %q", u.GetName(), u.GetAPIVersion())
+						}
+						kinds = append(kinds, u.GetKind())
+						return nil
+					},
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (metav1.TypeMeta{APIVersion: "v1", Kind: tt.listKind}); typeMeta != want {
+				t.Errorf("OnTypeMeta got %+v, want %+v", typeMeta, want)
+			}
+			if len(kinds) != len(tt.kinds) || kinds[0] != tt.kinds[0] || kinds[1] != tt.kinds[1] {
+				t.Errorf("kinds got %q, want %q", kinds, tt.kinds)
+			}
+		})
+	}
+}
+
+func TestStreamListDynamicDecoding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"kind":"DeploymentList","apiVersion":"apps/v1","metadata":{},"items":[` +
+			`{"metadata":{"name":"a"},"spec":{"replicas":3,"progressDeadlineSeconds":600.5}},` +
+			`{"metadata":{"name":"b"},"spec":{"replicas":1,"replicas":2}}]}`))
+	}))
+	defer srv.Close()
+
+	var items []*unstructured.Unstructured
+	strictErrs := map[int][]error{}
+	err := StreamListDynamic(context.Background(), &rest.Config{Host: srv.URL}, schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, "", metav1.ListOptions{},
+		TypedParamFuncs[unstructured.Unstructured]{
+			OnObjectFunc: func(u *unstructured.Unstructured) error {
+				items = append(items, u)
+				return nil
+			},
+		}, WithStrictJSON(func(index int, raw []byte, errs []error) error {
+			strictErrs[index] = errs
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("got %d items", len(items))
+	}
+	spec := items[0].Object["spec"].(map[string]interface{})
+	if replicas, ok := spec["replicas"].(int64); !ok || replicas != 3 {
+		t.Errorf("replicas got %T %v, want int64 3", spec["replicas"], spec["replicas"])
+	}
+	if seconds, ok := spec["progressDeadlineSeconds"].(float64); !ok || seconds != 600.5 {
+		t.Errorf("progressDeadlineSeconds got %T %v", spec["progressDeadlineSeconds"], spec["progressDeadlineSeconds"])
+	}
+	if items[1].GetKind() != "Deployment" || items[1].GetAPIVersion() != "apps/v1" {
+		t.Errorf("item 1 got %s %s", items[1].GetAPIVersion(), items[1].GetKind())
+	}
+	if len(strictErrs) != 1 || len(strictErrs[1]) != 1 || !strings.Contains(strictErrs[1][0].Error(), "duplicate field") {
+		t.Errorf("strict errors got %v, want a duplicate field for item 1", strictErrs)
+	}
+}
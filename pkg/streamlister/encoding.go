@@ -0,0 +1,279 @@
+package streamlister
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/json"
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/protobuf"
+)
+
+type Encoding string
+
+const (
+	EncodingProtobuf Encoding = "protobuf"
+	EncodingJSON     Encoding = "json"
+)
+
+var encodingContentTypes = map[Encoding]string{
+	EncodingProtobuf: runtime.ContentTypeProtobuf,
+	EncodingJSON:     runtime.ContentTypeJSON,
+}
+
+// WithEncodings restricts the Accept header to the given encodings in order of preference,
+// the default is protobuf then JSON. Unknown or no encodings fail the call with ErrInvalidOption.
+func WithEncodings(encodings ...Encoding) OptionFunc {
+	return func(options *streamListOptions) {
+		if len(encodings) == 0 {
+			options.invalid("WithEncodings: no encodings")
+			return
+		}
+		acceptContentTypes := make([]string, 0, len(encodings))
+		for _, encoding := range encodings {
+			contentType, ok := encodingContentTypes[encoding]
+			if !ok {
+				options.invalid("WithEncodings: unknown encoding %q", encoding)
+				return
+			}
+			acceptContentTypes = append(acceptContentTypes, contentType)
+		}
+		options.acceptContentTypes = acceptContentTypes
+	}
+}
+
+// UnsupportedEncodingError is returned when the response is neither protobuf nor JSON,
+// e.g. an HTML error page of a proxy.
+type UnsupportedEncodingError struct {
+	// ContentType is empty if the response header is not available.
+	ContentType string
+	// Prefix holds the first bytes of the response body.
+	Prefix []byte
+}
+
+func (e *UnsupportedEncodingError) Error() string {
+	return fmt.Sprintf("unsupported response encoding: contentType=%q prefix=%q", e.ContentType, e.Prefix)
+}
+
+const unsupportedPrefixLen = 64
+
+func unsupportedEncoding(contentType string, prefix []byte, r io.Reader) error {
+	buf := make([]byte, unsupportedPrefixLen)
+	n := copy(buf, prefix)
+	if n < len(buf) {
+		m, _ := io.ReadFull(r, buf[n:])
+		n += m
+	}
+	return &UnsupportedEncodingError{ContentType: contentType, Prefix: buf[:n]}
+}
+
+// detectEncoding trusts the Content-Type header if present, otherwise sniffs the prefix of the body.
+func detectEncoding(contentType string, prefix []byte) (Encoding, bool) {
+	if contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return "", false
+		}
+		switch mediaType {
+		case runtime.ContentTypeProtobuf:
+			return EncodingProtobuf, true
+		case runtime.ContentTypeJSON:
+			return EncodingJSON, true
+		default:
+			return "", false
+		}
+	}
+	if bytes.HasPrefix(prefix, protobuf.EncodingPrefix) {
+		return EncodingProtobuf, true
+	}
+	if len(prefix) > 0 && prefix[0] == '{' {
+		return EncodingJSON, true
+	}
+	return "", false
+}
+
+func decodeStream(r io.Reader, contentType string, param ParamWithErrorInterface, slo *streamListOptions, observer *requestObserver) (Encoding, error) {
+	r = slo.limitResponse(r)
+	prefix := make([]byte, len(protobuf.EncodingPrefix))
+	n, err := io.ReadFull(r, prefix)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", fmt.Errorf("rc.Read prefix: %w", err)
+	}
+	prefix = prefix[:n]
+
+	encoding, ok := detectEncoding(contentType, prefix)
+	if !ok {
+		return "", unsupportedEncoding(contentType, prefix, r)
+	}
+
+	var integrity *integrityParam
+	var onListEnd func(items int) error
+	if slo.integrity != nil {
+		integrity = &integrityParam{ParamWithErrorInterface: param}
+		param = integrity
+		onListEnd = integrity.onListEnd
+	}
+
+	switch encoding {
+	case EncodingProtobuf:
+		if !bytes.Equal(prefix, protobuf.EncodingPrefix) {
+			return encoding, errors.New("invalid protobuf encoding")
+		}
+
+		if !slo.protobufSupported {
+			return encoding, fmt.Errorf("%w: %s returned by ObjectFactory", ErrProtobufUnsupported, slo.objectType)
+		}
+		o := param.ObjectFactory()
+		filter, err := newObjectFilter(o, slo)
+		if err != nil {
+			return encoding, err
+		}
+		var protobufFilter func(raw []byte) (bool, error)
+		if filter != nil {
+			protobufFilter = filter.protobufFilter()
+		}
+		pruner, err := newObjectPruner(o, slo)
+		if err != nil {
+			return encoding, err
+		}
+		var protobufPruner func(raw []byte) (int, error)
+		if pruner != nil {
+			protobufPruner = pruner.protobufPruner()
+		}
+
+		env := &envelope{limitResponse: slo.limitResponse}
+		listParam := &envelopeParam{ParamWithErrorInterface: param, env: env}
+		if err := (protobuf.UnknownStreamUnmarshaler{
+			OnRaw: func(raw *protobuf.StreamBuffer) error {
+				return env.onRaw(raw, func(buffer *protobuf.StreamBuffer) error {
+					if err := (protobuf.ListStreamUnmarshaler{
+						Workers:          slo.decodeWorkers,
+						Unordered:        slo.unorderedDelivery,
+						OnUnknownField:   slo.unknownFieldHook("List"),
+						OnDecoded:        observer.itemDecodeHook(encoding),
+						OnItemError:      env.onItemError(slo.onItemError),
+						Filter:           protobufFilter,
+						Prune:            protobufPruner,
+						MaxItemBytes:     intLimit(slo.limits.MaxItemBytes),
+						MaxItems:         slo.limits.MaxItems,
+						MaxResponseBytes: intLimit(slo.limits.MaxResponseBytes),
+						OnListEnd:        onListEnd,
+					}).Unmarshal(buffer, listParam); err != nil {
+						return fmt.Errorf("protobuf.UnmarshalListStream: %w", err)
+					}
+					return nil
+				})
+			},
+			OnTypeMeta:        param.OnTypeMeta,
+			OnContentEncoding: env.onContentEncoding,
+			OnContentType:     env.onContentType,
+			OnUnknownField:    slo.unknownFieldHook("Unknown"),
+			MaxResponseBytes:  intLimit(slo.limits.MaxResponseBytes),
+		}).Unmarshal(protobuf.NewStreamBuffer(r, -1)); err != nil {
+			return encoding, fmt.Errorf("protobuf.UnmarshalUnknown: %w", err)
+		}
+		if err := env.finish(); err != nil {
+			return encoding, fmt.Errorf("protobuf.UnmarshalUnknown: %w", err)
+		}
+	case EncodingJSON:
+		o := param.ObjectFactory()
+		pruner, err := newObjectPruner(o, slo)
+		if err != nil {
+			return encoding, err
+		}
+		if pruner != nil {
+			param = &pruneParam{ParamWithErrorInterface: param, pruner: pruner}
+		}
+		// The filter sees items before they are pruned, same as with protobuf.
+		filter, err := newObjectFilter(o, slo)
+		if err != nil {
+			return encoding, err
+		}
+		var jsonFilter func(obj runtime.Object) (bool, error)
+		if filter != nil {
+			jsonFilter = filter.match
+		}
+		if err := (json.ListStreamUnmarshaler{
+			OnDecoded:     observer.itemDecodeHook(encoding),
+			OnItemError:   slo.onItemError,
+			Filter:        jsonFilter,
+			OnStrictError: slo.strictErrorHook(),
+			MaxItemBytes:  slo.limits.MaxItemBytes,
+			MaxItems:      slo.limits.MaxItems,
+			OnListEnd:     onListEnd,
+		}).Unmarshal(io.MultiReader(bytes.NewReader(prefix), r), param); err != nil {
+			return encoding, fmt.Errorf("json.Unmarshal: %w", err)
+		}
+	}
+	if integrity != nil {
+		return encoding, slo.integrity.response(integrity)
+	}
+	return encoding, nil
+}
+
+// responseRecorder keeps the header of the last response passing through it.
+type responseRecorder struct {
+	rt     http.RoundTripper
+	header http.Header
+}
+
+func (r *responseRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.rt.RoundTrip(req)
+	if resp != nil {
+		r.header = resp.Header
+	}
+	return resp, err
+}
+
+// responseHeader returns nil if the header is not recorded.
+func (r *responseRecorder) responseHeader() http.Header {
+	if r == nil {
+		return nil
+	}
+	return r.header
+}
+
+// contentType returns an empty string if the header is not recorded.
+func (r *responseRecorder) contentType() string {
+	if r == nil || r.header == nil {
+		return ""
+	}
+	return r.header.Get("Content-Type")
+}
+
+// contentEncoding returns an empty string if the header is not recorded.
+func (r *responseRecorder) contentEncoding() string {
+	if r == nil || r.header == nil {
+		return ""
+	}
+	return r.header.Get("Content-Encoding")
+}
+
+// withResponseRecorder returns a copy of client whose responses are recorded,
+// the original client and nil are returned if it is not a *rest.RESTClient.
+func withResponseRecorder(client rest.Interface) (rest.Interface, *responseRecorder) {
+	restClient, ok := client.(*rest.RESTClient)
+	if !ok {
+		return client, nil
+	}
+	httpClient := restClient.Client
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	rt := httpClient.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	recorder := &responseRecorder{rt: rt}
+	copiedHTTPClient := *httpClient
+	copiedHTTPClient.Transport = recorder
+	copiedClient := *restClient
+	copiedClient.Client = &copiedHTTPClient
+	return &copiedClient, recorder
+}
@@ -0,0 +1,115 @@
+package streamlister
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest/fake"
+)
+
+func TestAcceptHeaderObjectType(t *testing.T) {
+	partialMetadata := func() runtime.Object { return &metav1.PartialObjectMetadata{} }
+	tests := []struct {
+		name string
+		// object defaults to *unstructured.Unstructured, which can not be decoded from protobuf.
+		object func() runtime.Object
+		opts   []OptionFunc
+		accept string
+	}{
+		{name: "default", accept: runtime.ContentTypeJSON},
+		{name: "protobuf only", opts: []OptionFunc{WithEncodings(EncodingProtobuf)}, accept: runtime.ContentTypeProtobuf},
+		{
+			name:   "partial metadata",
+			object: partialMetadata,
+			opts:   []OptionFunc{WithPartialObjectMetadata()},
+			accept: runtime.ContentTypeProtobuf + ";as=PartialObjectMetadataList;g=meta.k8s.io;v=v1," +
+				runtime.ContentTypeJSON + ";as=PartialObjectMetadataList;g=meta.k8s.io;v=v1," + runtime.ContentTypeJSON,
+		},
+		{
+			name:   "partial metadata json",
+			object: partialMetadata,
+			opts:   []OptionFunc{WithPartialObjectMetadata(), WithEncodings(EncodingJSON)},
+			accept: runtime.ContentTypeJSON + ";as=PartialObjectMetadataList;g=meta.k8s.io;v=v1," + runtime.ContentTypeJSON,
+		},
+		{
+			name:   "partial metadata protobuf only",
+			object: partialMetadata,
+			opts:   []OptionFunc{WithPartialObjectMetadata(), WithEncodings(EncodingProtobuf)},
+			accept: runtime.ContentTypeProtobuf + ";as=PartialObjectMetadataList;g=meta.k8s.io;v=v1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var accepts []string
+			client := &fake.RESTClient{
+				GroupVersion:         schema.GroupVersion{Version: "v1"},
+				NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+				Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+					accepts = append(accepts, req.Header.Get("Accept"))
+					header := http.Header{}
+					header.Set("Content-Type", runtime.ContentTypeJSON)
+					body := []byte(`{"kind":"PodList","apiVersion":"v1","metadata":{},"items":[]}`)
+					return &http.Response{StatusCode: http.StatusOK, Header: header, Body: ioutil.NopCloser(bytes.NewReader(body))}, nil
+				}),
+			}
+			object := tt.object
+			if object == nil {
+				object = func() runtime.Object { return &unstructured.Unstructured{} }
+			}
+			err := StreamList(context.Background(), client, "pods", "", metav1.ListOptions{}, ParamFuncs{
+				ObjectFactoryFunc: object,
+				OnObjectFunc:      func(runtime.Object) {},
+			}, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(accepts) != 1 || accepts[0] != tt.accept {
+				t.Errorf("Accept got %q, want %q", accepts, tt.accept)
+			}
+		})
+	}
+}
+
+func TestInvalidEncodingOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  OptionFunc
+	}{
+		{name: "unknown content encoding", opt: WithContentEncodings(ContentEncodingGzip, "br")},
+		{name: "misspelled content encoding", opt: WithContentEncodings("gzp")},
+		{name: "unknown encoding", opt: WithEncodings(EncodingJSON, "yaml")},
+		{name: "no encodings", opt: WithEncodings()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			client := &fake.RESTClient{
+				GroupVersion:         schema.GroupVersion{Version: "v1"},
+				NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+				Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+					requests++
+					return nil, errors.New("unexpected request")
+				}),
+			}
+			err := StreamList(context.Background(), client, "pods", "", metav1.ListOptions{}, ParamFuncs{
+				ObjectFactoryFunc: func() runtime.Object { return &unstructured.Unstructured{} },
+				OnObjectFunc:      func(runtime.Object) {},
+			}, tt.opt)
+			if !errors.Is(err, ErrInvalidOption) {
+				t.Fatalf("error got %v, want ErrInvalidOption", err)
+			}
+			if requests != 0 {
+				t.Errorf("got %d requests", requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package streamlister
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/protobuf"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// EnvelopeError is returned when the runtime.Unknown envelope of a protobuf response
+// carries a payload which can not be decoded as a protobuf list.
+type EnvelopeError struct {
+	ContentEncoding string
+	ContentType     string
+}
+
+func (e *EnvelopeError) Error() string {
+	return fmt.Sprintf("unsupported runtime.Unknown payload: contentEncoding=%q contentType=%q", e.ContentEncoding, e.ContentType)
+}
+
+// envelope tracks ContentEncoding and ContentType of runtime.Unknown. They are marshaled after Raw, so Raw
+// is only decoded as a list if it starts like one, and checked against them once they arrive. Otherwise Raw
+// is skipped and EnvelopeError reports the fields once the envelope is read.
+type envelope struct {
+	contentEncoding     string
+	contentEncodingSeen bool
+	contentType         string
+	contentTypeSeen     bool
+	rawSeen             bool
+	rawEncoding         string
+	// rawContentType is the content type sniffed from Raw if it is not a protobuf list.
+	rawContentType string
+	// notList is set if Raw is skipped, rawErr if it failed to decode for another reason than the caller.
+	notList bool
+	rawErr  error
+	// callerFailed is set once a callback of the caller returned an error.
+	callerFailed bool
+
+	// limitResponse limits the decompressed size of Raw.
+	limitResponse func(io.Reader) io.Reader
+}
+
+func (e *envelope) onContentEncoding(contentEncoding string) error {
+	e.contentEncoding = contentEncoding
+	e.contentEncodingSeen = true
+	if contentEncoding != "" && contentEncoding != "gzip" {
+		return &EnvelopeError{ContentEncoding: contentEncoding, ContentType: e.contentType}
+	}
+	if e.rawSeen && !e.notList && contentEncoding != e.rawEncoding {
+		return &EnvelopeError{ContentEncoding: contentEncoding, ContentType: e.contentType}
+	}
+	return nil
+}
+
+func (e *envelope) onContentType(contentType string) error {
+	e.contentType = contentType
+	e.contentTypeSeen = true
+	if contentType == "" {
+		return nil
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != runtime.ContentTypeProtobuf {
+		return &EnvelopeError{ContentEncoding: e.contentEncoding, ContentType: contentType}
+	}
+	return nil
+}
+
+// onRaw decodes Raw with decodeList if it is a protobuf list. Raw is drained instead if it is not, or if it
+// fails to decode without the caller being involved, so that the fields after it can explain why.
+func (e *envelope) onRaw(raw *protobuf.StreamBuffer, decodeList func(*protobuf.StreamBuffer) error) error {
+	buffer, err := e.rawStream(raw)
+	if err != nil {
+		return err
+	}
+	if buffer == nil {
+		e.notList = true
+		return raw.Discard()
+	}
+	err = decodeList(buffer)
+	if err == nil {
+		return nil
+	}
+	var limitErr *LimitExceededError
+	var bodyErr *bodyReadError
+	if e.callerFailed || errors.As(err, &limitErr) || errors.As(err, &bodyErr) {
+		return err
+	}
+	if discardErr := raw.Discard(); discardErr != nil {
+		return err
+	}
+	e.rawErr = err
+	return nil
+}
+
+// finish returns the error of Raw once the envelope is read without error.
+func (e *envelope) finish() error {
+	if e.notList {
+		contentType := e.contentType
+		if contentType == "" {
+			contentType = e.rawContentType
+		}
+		contentEncoding := e.contentEncoding
+		if contentEncoding == "" {
+			contentEncoding = e.rawEncoding
+		}
+		return &EnvelopeError{ContentEncoding: contentEncoding, ContentType: contentType}
+	}
+	return e.rawErr
+}
+
+// rawStream returns the decoded Raw of runtime.Unknown, or nil if it is not a protobuf list.
+func (e *envelope) rawStream(buffer *protobuf.StreamBuffer) (*protobuf.StreamBuffer, error) {
+	e.rawSeen = true
+	e.rawEncoding = e.contentEncoding
+	if !e.contentEncodingSeen {
+		head, err := buffer.Peek(len(gzipMagic))
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(head, gzipMagic) {
+			e.rawEncoding = "gzip"
+		}
+	}
+
+	if e.rawEncoding == "gzip" {
+		gr, err := gzip.NewReader(buffer.Reader())
+		if err != nil {
+			return nil, fmt.Errorf("gzip.NewReader: %w", err)
+		}
+		var r io.Reader = gr
+		if e.limitResponse != nil {
+			r = e.limitResponse(r)
+		}
+		buffer = protobuf.NewStreamBuffer(r, -1)
+	}
+
+	head, err := buffer.Peek(listPeekSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(head) > 0 && (head[0] == '{' || head[0] == '[') {
+		e.rawContentType = runtime.ContentTypeJSON
+		return nil, nil
+	}
+	if !startsLikeList(head, len(head) == listPeekSize) {
+		return nil, nil
+	}
+	return buffer, nil
+}
+
+// listPeekSize is enough for the ListMeta the apiserver puts first in every list.
+const listPeekSize = 16 * 1024
+
+// startsLikeList checks that head is empty or starts with a ListMeta, truncated tells that the message
+// goes on after head.
+func startsLikeList(head []byte, truncated bool) bool {
+	if len(head) == 0 {
+		return true
+	}
+	f, err := protobuf.NextField(head, 0)
+	if err == io.ErrUnexpectedEOF {
+		// Either a long ListMeta or a truncated response, which the list decoder reports.
+		return head[0] == 0x0a
+	}
+	if err != nil || f.Num != 1 || f.WireType != 2 {
+		return false
+	}
+	var listMeta metav1.ListMeta
+	return listMeta.Unmarshal(f.Bytes) == nil
+}
+
+// envelopeParam marks errors returned by the caller, which are never explained by the envelope.
+type envelopeParam struct {
+	ParamWithErrorInterface
+	env *envelope
+}
+
+func (p *envelopeParam) check(err error) error {
+	if err != nil {
+		p.env.callerFailed = true
+	}
+	return err
+}
+
+func (p *envelopeParam) OnListMeta(meta *metav1.ListMeta) error {
+	return p.check(p.ParamWithErrorInterface.OnListMeta(meta))
+}
+
+func (p *envelopeParam) OnTypeMeta(meta *metav1.TypeMeta) error {
+	return p.check(p.ParamWithErrorInterface.OnTypeMeta(meta))
+}
+
+func (p *envelopeParam) OnObject(obj runtime.Object) error {
+	return p.check(p.ParamWithErrorInterface.OnObject(obj))
+}
+
+// onItemError wraps the item error hook of the caller.
+func (e *envelope) onItemError(hook func(index int, raw []byte, err error) error) func(index int, raw []byte, err error) error {
+	if hook == nil {
+		return nil
+	}
+	return func(index int, raw []byte, err error) error {
+		if err := hook(index, raw, err); err != nil {
+			e.callerFailed = true
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,137 @@
+package streamlister
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// brotliStored encodes data as a brotli stream of a single uncompressed meta-block.
+func brotliStored(data []byte) []byte {
+	// WBITS=16, ISLAST=0, MNIBBLES=4, MLEN-1, ISUNCOMPRESSED=1, padded to a byte boundary.
+	header := uint32(len(data)-1)<<4 | 1<<20
+	out := []byte{byte(header), byte(header >> 8), byte(header >> 16)}
+	out = append(out, data...)
+	// ISLAST=1, ISLASTEMPTY=1.
+	return append(out, 0x03)
+}
+
+func envelopeBody(t *testing.T, raw []byte, contentEncoding, contentType string) []byte {
+	unknown := runtime.Unknown{
+		TypeMeta:        runtime.TypeMeta{APIVersion: "v1", Kind: "PodList"},
+		Raw:             raw,
+		ContentEncoding: contentEncoding,
+		ContentType:     contentType,
+	}
+	body, err := unknown.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append([]byte("k8s\x00"), body...)
+}
+
+func TestStreamListEnvelope(t *testing.T) {
+	list := &corev1.PodList{
+		ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+		Items: []corev1.Pod{
+			{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default"}},
+		},
+	}
+	raw, err := list.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listMeta, err := list.ListMeta.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gzipped, deflated bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	_, _ = gw.Write(raw)
+	_ = gw.Close()
+	fw, _ := flate.NewWriter(&deflated, flate.DefaultCompression)
+	_, _ = fw.Write(raw)
+	_ = fw.Close()
+	yaml := []byte("apiVersion: v1\nitems:\n- metadata:\n    name: a\n- metadata:\n    name: b\nkind: PodList\nmetadata:\n  resourceVersion: \"1\"\n")
+
+	tests := []struct {
+		name            string
+		raw             []byte
+		contentEncoding string
+		contentType     string
+		// wantErr is the expected EnvelopeError, nil if the list decodes.
+		wantErr *EnvelopeError
+	}{
+		{name: "plain", raw: raw},
+		{name: "gzip", raw: gzipped.Bytes(), contentEncoding: "gzip"},
+		{name: "protobuf content type", raw: raw, contentType: runtime.ContentTypeProtobuf},
+		{
+			name: "deflate", raw: deflated.Bytes(), contentEncoding: "deflate",
+			wantErr: &EnvelopeError{ContentEncoding: "deflate"},
+		},
+		{
+			name: "br", raw: brotliStored(raw), contentEncoding: "br",
+			wantErr: &EnvelopeError{ContentEncoding: "br"},
+		},
+		{
+			// Raw starts like a list, the decode error is explained by the envelope.
+			name: "br after list metadata", raw: append(append([]byte{0x0a, byte(len(listMeta))}, listMeta...), 0xff, 0xff), contentEncoding: "br",
+			wantErr: &EnvelopeError{ContentEncoding: "br"},
+		},
+		{
+			name: "yaml", raw: yaml, contentType: "application/yaml",
+			wantErr: &EnvelopeError{ContentType: "application/yaml"},
+		},
+		{
+			name: "json", raw: []byte(`{"kind":"PodList","apiVersion":"v1","metadata":{},"items":[]}`), contentType: runtime.ContentTypeJSON,
+			wantErr: &EnvelopeError{ContentType: runtime.ContentTypeJSON},
+		},
+		{
+			name: "gzip json without content type", raw: func() []byte {
+				var b bytes.Buffer
+				w := gzip.NewWriter(&b)
+				_, _ = w.Write([]byte(`{"items":[]}`))
+				_ = w.Close()
+				return b.Bytes()
+			}(),
+			wantErr: &EnvelopeError{ContentEncoding: "gzip", ContentType: runtime.ContentTypeJSON},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fakeClient(runtime.ContentTypeProtobuf, envelopeBody(t, tt.raw, tt.contentEncoding, tt.contentType))
+			var names []string
+			err := StreamList(context.Background(), client, "pods", "", metav1.ListOptions{}, ParamFuncs{
+				ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+				OnObjectFunc:      func(o runtime.Object) { names = append(names, o.(*corev1.Pod).Name) },
+			})
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(names) != 2 {
+					t.Errorf("OnObject got %v", names)
+				}
+				return
+			}
+			var envErr *EnvelopeError
+			if !errors.As(err, &envErr) {
+				t.Fatalf("error got %v, want EnvelopeError", err)
+			}
+			if *envErr != *tt.wantErr {
+				t.Errorf("EnvelopeError got %+v, want %+v", *envErr, *tt.wantErr)
+			}
+			if len(names) != 0 {
+				t.Errorf("OnObject got %v before the envelope was known", names)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package streamlister
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+)
+
+const defaultFanOutConcurrency = 4
+
+// Target is a single list of StreamListFanOut.
+type Target struct {
+	// Client overrides the client passed to StreamListFanOut, e.g. for a resource of another group version.
+	Client      rest.Interface
+	Resource    string
+	Namespace   string
+	ListOptions metav1.ListOptions
+}
+
+func (t *Target) String() string {
+	if t.Namespace == "" {
+		return t.Resource
+	}
+	return t.Namespace + "/" + t.Resource
+}
+
+// FanOutParamInterface is ParamWithErrorInterface for StreamListFanOut, target points into the slice of targets.
+type FanOutParamInterface interface {
+	// ObjectFactory has the same requirements as ParamInterface.ObjectFactory.
+	ObjectFactory(target *Target) runtime.Object
+	OnListMeta(target *Target, meta *metav1.ListMeta) error
+	OnTypeMeta(target *Target, meta *metav1.TypeMeta) error
+	OnObject(target *Target, obj runtime.Object) error
+}
+
+type FanOutParamFuncs struct {
+	ObjectFactoryFunc func(target *Target) runtime.Object
+	OnListMetaFunc    func(target *Target, meta *metav1.ListMeta) error
+	OnTypeMetaFunc    func(target *Target, meta *metav1.TypeMeta) error
+	OnObjectFunc      func(target *Target, obj runtime.Object) error
+}
+
+func (p FanOutParamFuncs) ObjectFactory(target *Target) runtime.Object {
+	return p.ObjectFactoryFunc(target)
+}
+
+func (p FanOutParamFuncs) OnListMeta(target *Target, meta *metav1.ListMeta) error {
+	onListMetaFunc := p.OnListMetaFunc
+	if onListMetaFunc != nil {
+		return onListMetaFunc(target, meta)
+	}
+	return nil
+}
+
+func (p FanOutParamFuncs) OnTypeMeta(target *Target, meta *metav1.TypeMeta) error {
+	onTypeMetaFunc := p.OnTypeMetaFunc
+	if onTypeMetaFunc != nil {
+		return onTypeMetaFunc(target, meta)
+	}
+	return nil
+}
+
+func (p FanOutParamFuncs) OnObject(target *Target, obj runtime.Object) error {
+	return p.OnObjectFunc(target, obj)
+}
+
+// WithFanOutConcurrency sets how many targets StreamListFanOut lists at the same time, the default is 4.
+func WithFanOutConcurrency(concurrency int) OptionFunc {
+	return func(options *streamListOptions) {
+		options.fanOutConcurrency = concurrency
+	}
+}
+
+// WithFanOutBestEffort makes StreamListFanOut list every target even if some of them fail,
+// by default the first failure cancels the others.
+func WithFanOutBestEffort() OptionFunc {
+	return func(options *streamListOptions) {
+		options.fanOutBestEffort = true
+	}
+}
+
+type TargetError struct {
+	Target *Target
+	Err    error
+}
+
+func (e *TargetError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Target, e.Err)
+}
+
+func (e *TargetError) Unwrap() error {
+	return e.Err
+}
+
+// ErrTargetNotStarted is reported for the targets StreamListFanOut did not start because another target failed.
+var ErrTargetNotStarted = errors.New("target not started")
+
+// FanOutError holds the failed targets of StreamListFanOut in the order of targets. Unless WithFanOutBestEffort
+// is used, it also holds the targets canceled or not started after the first failure.
+type FanOutError struct {
+	Errors []*TargetError
+}
+
+func (e *FanOutError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d targets failed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Is reports whether any target failed with target, errors.Is does not follow Unwrap() []error before Go 1.20.
+func (e *FanOutError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error of the failed targets matching target.
+func (e *FanOutError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *FanOutError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// StreamListFanOut lists all targets with bounded concurrency into a single param, calls of param including
+// ObjectFactory are serialized and tagged with their target. Returning ErrStop from param stops all targets.
+// Failed targets are reported as *FanOutError, opts apply to every target on its own.
+func StreamListFanOut(ctx context.Context, client rest.Interface, targets []Target, param FanOutParamInterface, opts ...OptionFunc) error {
+	slo, err := newOptions(opts, nil)
+	if err != nil {
+		return err
+	}
+	concurrency := slo.fanOutConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultFanOutConcurrency
+	}
+	if slo.sharedCapture && concurrency > 1 {
+		return fmt.Errorf("%w: WithRecord can not be shared by %d concurrent targets, use WithRecordDir or WithFanOutConcurrency(1)",
+			ErrInvalidOption, concurrency)
+	}
+
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	f := &fanOut{param: param}
+	errs := make([]error, len(targets))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range targets {
+		select {
+		case sem <- struct{}{}:
+		case <-listCtx.Done():
+		}
+		if listCtx.Err() != nil {
+			notStarted := ctx.Err()
+			if notStarted == nil {
+				notStarted = ErrTargetNotStarted
+			}
+			for ; i < len(targets); i++ {
+				errs[i] = notStarted
+			}
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			target := &targets[i]
+			targetClient := target.Client
+			if targetClient == nil {
+				targetClient = client
+			}
+			err := streamList(listCtx, targetClient, target.Resource, target.Namespace, target.ListOptions, &fanOutParam{fanOut: f, target: target}, opts...)
+			if err == nil {
+				return
+			}
+			if errors.Is(err, ErrStop) {
+				f.halt(true)
+				cancel()
+				return
+			}
+			errs[i] = err
+			if !slo.fanOutBestEffort {
+				f.halt(false)
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if f.stopped {
+		return nil
+	}
+	var fanOutErr FanOutError
+	for i, err := range errs {
+		if err != nil {
+			fanOutErr.Errors = append(fanOutErr.Errors, &TargetError{Target: &targets[i], Err: err})
+		}
+	}
+	if len(fanOutErr.Errors) > 0 {
+		return &fanOutErr
+	}
+	return nil
+}
+
+// fanOut serializes the calls of param, nothing is passed to it once it is halted.
+type fanOut struct {
+	mu     sync.Mutex
+	param  FanOutParamInterface
+	halted bool
+	// stopped is set if param returned ErrStop, otherwise a target failed fast.
+	stopped bool
+}
+
+func (f *fanOut) halt(stopped bool) {
+	f.mu.Lock()
+	f.halted = true
+	f.stopped = f.stopped || stopped
+	f.mu.Unlock()
+}
+
+// call runs fn unless the fan-out is halted, ErrStop halts it before any other call can run.
+func (f *fanOut) call(fn func() error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.halted {
+		return context.Canceled
+	}
+	err := fn()
+	if errors.Is(err, ErrStop) {
+		f.halted = true
+		f.stopped = true
+	}
+	return err
+}
+
+type fanOutParam struct {
+	*fanOut
+	target *Target
+}
+
+func (p *fanOutParam) ObjectFactory() runtime.Object {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.param.ObjectFactory(p.target)
+}
+
+func (p *fanOutParam) OnListMeta(meta *metav1.ListMeta) error {
+	return p.call(func() error {
+		return p.param.OnListMeta(p.target, meta)
+	})
+}
+
+func (p *fanOutParam) OnTypeMeta(meta *metav1.TypeMeta) error {
+	return p.call(func() error {
+		return p.param.OnTypeMeta(p.target, meta)
+	})
+}
+
+func (p *fanOutParam) OnObject(obj runtime.Object) error {
+	return p.call(func() error {
+		return p.param.OnObject(p.target, obj)
+	})
+}
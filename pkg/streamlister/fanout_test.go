@@ -0,0 +1,171 @@
+package streamlister
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+func TestFanOutErrorIsAs(t *testing.T) {
+	targets := []Target{{Resource: "pods", Namespace: "a"}, {Resource: "pods", Namespace: "b"}}
+	err := error(&FanOutError{Errors: []*TargetError{
+		{Target: &targets[0], Err: fmt.Errorf("list: %w", context.DeadlineExceeded)},
+		{Target: &targets[1], Err: fmt.Errorf("list: %w", &IntegrityError{Reason: "truncated"})},
+	}})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("errors.Is does not find the error of the first target")
+	}
+	if errors.Is(err, context.Canceled) {
+		t.Error("errors.Is finds an error no target failed with")
+	}
+	var integrityErr *IntegrityError
+	if !errors.As(err, &integrityErr) || integrityErr.Reason != "truncated" {
+		t.Errorf("errors.As got %v", integrityErr)
+	}
+	var targetErr *TargetError
+	if !errors.As(err, &targetErr) || targetErr.Target != &targets[0] {
+		t.Errorf("errors.As got %v, want the first target", targetErr)
+	}
+}
+
+// namespacePodsServer serves a JSON PodList holding a single pod named after the namespace,
+// listing the namespace "fail" fails.
+func namespacePodsServer(t *testing.T) *rest.Config {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// /api/v1/namespaces/<namespace>/pods
+		namespace := strings.Split(r.URL.Path, "/")[4]
+		if namespace == "fail" {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", runtime.ContentTypeJSON)
+		fmt.Fprintf(w, `{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"1"},"items":[{"metadata":{"name":%q,"namespace":%q}}]}`,
+			namespace, namespace)
+	}))
+	t.Cleanup(srv.Close)
+	return &rest.Config{Host: srv.URL}
+}
+
+func TestStreamListFanOutRecord(t *testing.T) {
+	client, err := NewRESTClient(namespacePodsServer(t), schema.GroupVersion{Version: "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets []Target
+	for _, namespace := range []string{"a", "b", "c", "d"} {
+		targets = append(targets, Target{Resource: "pods", Namespace: namespace})
+	}
+	param := func(names *[]string) FanOutParamFuncs {
+		return FanOutParamFuncs{
+			ObjectFactoryFunc: func(*Target) runtime.Object { return &corev1.Pod{} },
+			OnObjectFunc: func(_ *Target, o runtime.Object) error {
+				*names = append(*names, o.(*corev1.Pod).Name)
+				return nil
+			},
+		}
+	}
+
+	t.Run("concurrent", func(t *testing.T) {
+		var capture bytes.Buffer
+		var names []string
+		err := StreamListFanOut(context.Background(), client, targets, param(&names),
+			WithRecord(&capture, RecordOptions{}), WithFanOutConcurrency(2))
+		if !errors.Is(err, ErrInvalidOption) {
+			t.Fatalf("error got %v, want ErrInvalidOption", err)
+		}
+		if capture.Len() != 0 || len(names) != 0 {
+			t.Error("targets listed despite the invalid option")
+		}
+	})
+
+	t.Run("sequential", func(t *testing.T) {
+		var capture bytes.Buffer
+		var names []string
+		err := StreamListFanOut(context.Background(), client, targets, param(&names),
+			WithRecord(&capture, RecordOptions{}), WithFanOutConcurrency(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var replayed []string
+		err = ReplayCapture(context.Background(), &capture, ParamWithErrorFuncs{
+			ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+			OnObjectFunc: func(o runtime.Object) error {
+				replayed = append(replayed, o.(*corev1.Pod).Name)
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(names)
+		if want := "a,b,c,d"; strings.Join(names, ",") != want || strings.Join(replayed, ",") != want {
+			t.Errorf("listed %v, replayed %v, want %s", names, replayed, want)
+		}
+	})
+}
+
+func TestStreamListFanOutFailure(t *testing.T) {
+	client, err := NewRESTClient(namespacePodsServer(t), schema.GroupVersion{Version: "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets []Target
+	for _, namespace := range []string{"a", "fail", "c", "d"} {
+		targets = append(targets, Target{Resource: "pods", Namespace: namespace})
+	}
+	param := FanOutParamFuncs{
+		ObjectFactoryFunc: func(*Target) runtime.Object { return &corev1.Pod{} },
+		OnObjectFunc:      func(*Target, runtime.Object) error { return nil },
+	}
+
+	tests := []struct {
+		name string
+		opts []OptionFunc
+		// want is the error of each failed target, "" for the targets listed successfully.
+		want []string
+	}{
+		{name: "fail fast", want: []string{"", "internal error", "not started", "not started"}},
+		{name: "best effort", opts: []OptionFunc{WithFanOutBestEffort()}, want: []string{"", "internal error", "", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := StreamListFanOut(context.Background(), client, targets, param, append(tt.opts, WithFanOutConcurrency(1))...)
+			var fanOutErr *FanOutError
+			if !errors.As(err, &fanOutErr) {
+				t.Fatalf("got %v, want FanOutError", err)
+			}
+			got := make([]string, len(targets))
+			for _, targetErr := range fanOutErr.Errors {
+				for i := range targets {
+					if targetErr.Target != &targets[i] {
+						continue
+					}
+					switch {
+					case apierrors.IsInternalError(targetErr.Err):
+						got[i] = "internal error"
+					case errors.Is(targetErr.Err, ErrTargetNotStarted):
+						got[i] = "not started"
+					default:
+						got[i] = targetErr.Err.Error()
+					}
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package streamlister
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/fieldpath"
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/protobuf"
+)
+
+// FilterItem is the part of an item available to the filter of WithFilter.
+type FilterItem struct {
+	ObjectMeta *metav1.ObjectMeta
+	// Fields holds the values of the field paths given to WithFilter formatted as strings,
+	// fields which are not set are absent.
+	Fields map[string]string
+}
+
+// WithFilter skips items for which filter returns false, fieldPaths are JSON paths of scalar fields like
+// "spec.nodeName" to be made available in FilterItem.Fields.
+// With protobuf only the metadata and the given fields are decoded before the filter is called,
+// an item is fully unmarshalled only if it matches. With JSON the filter is called after decoding.
+func WithFilter(filter func(item *FilterItem) bool, fieldPaths ...string) OptionFunc {
+	return func(options *streamListOptions) {
+		options.filter = filter
+		options.filterFieldPaths = fieldPaths
+	}
+}
+
+var objectMetaType = reflect.TypeOf(metav1.ObjectMeta{})
+
+type objectFilter struct {
+	filter   func(item *FilterItem) bool
+	metadata fieldpath.Path
+	fields   []fieldpath.Path
+}
+
+// newObjectFilter resolves the field paths on the type of obj, returning nil if there is no filter.
+func newObjectFilter(obj runtime.Object, slo *streamListOptions) (*objectFilter, error) {
+	if slo.filter == nil {
+		return nil, nil
+	}
+	f := &objectFilter{filter: slo.filter}
+	if _, ok := obj.(runtime.Unstructured); ok {
+		for _, path := range slo.filterFieldPaths {
+			f.fields = append(f.fields, fieldpath.Path{JSON: strings.Split(path, ".")})
+		}
+		return f, nil
+	}
+	t := reflect.TypeOf(obj)
+	var err error
+	f.metadata, err = fieldpath.Resolve(t, "metadata")
+	if err != nil {
+		return nil, fmt.Errorf("filter: %w", err)
+	}
+	if f.metadata.Type != objectMetaType {
+		return nil, fmt.Errorf("filter: metadata of %s is %s", t, f.metadata.Type)
+	}
+	for _, path := range slo.filterFieldPaths {
+		p, err := fieldpath.Resolve(t, path)
+		if err != nil {
+			return nil, fmt.Errorf("filter: %w", err)
+		}
+		if !fieldpath.IsScalar(p.Type) {
+			return nil, fmt.Errorf("filter: field path %q is %s, not a scalar", path, p.Type)
+		}
+		f.fields = append(f.fields, p)
+	}
+	return f, nil
+}
+
+// protobufFilter decodes only the metadata and the selected fields of the raw item.
+func (f *objectFilter) protobufFilter() func(raw []byte) (bool, error) {
+	paths := make([][]int32, 0, len(f.fields)+1)
+	paths = append(paths, f.metadata.Proto)
+	for _, p := range f.fields {
+		paths = append(paths, p.Proto)
+	}
+	return func(raw []byte) (bool, error) {
+		item := &FilterItem{ObjectMeta: &metav1.ObjectMeta{}}
+		if len(f.fields) > 0 {
+			item.Fields = make(map[string]string, len(f.fields))
+		}
+		if err := protobuf.ScanFields(raw, paths, func(path int, field protobuf.Field) error {
+			if path == 0 {
+				return item.ObjectMeta.Unmarshal(field.Bytes)
+			}
+			p := f.fields[path-1]
+			if field.WireType == 2 {
+				item.Fields[p.String()] = string(field.Bytes)
+			} else {
+				item.Fields[p.String()] = fieldpath.FormatVarint(p.Type, field.Varint)
+			}
+			return nil
+		}); err != nil {
+			return false, fmt.Errorf("filter: %w", err)
+		}
+		return f.filter(item), nil
+	}
+}
+
+// match reads the filter item from a decoded object.
+func (f *objectFilter) match(obj runtime.Object) (bool, error) {
+	item := &FilterItem{}
+	if len(f.fields) > 0 {
+		item.Fields = make(map[string]string, len(f.fields))
+	}
+	if u, ok := obj.(runtime.Unstructured); ok {
+		content := u.UnstructuredContent()
+		item.ObjectMeta = &metav1.ObjectMeta{}
+		if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(metadata, item.ObjectMeta); err != nil {
+				return false, fmt.Errorf("filter: metadata: %w", err)
+			}
+		}
+		for _, p := range f.fields {
+			if v, found, _ := unstructured.NestedFieldNoCopy(content, p.JSON...); found && v != nil {
+				item.Fields[p.String()] = fmt.Sprint(v)
+			}
+		}
+		return f.filter(item), nil
+	}
+
+	v := reflect.ValueOf(obj)
+	metadata, _ := f.metadata.Value(v)
+	item.ObjectMeta = metadata.Addr().Interface().(*metav1.ObjectMeta)
+	for _, p := range f.fields {
+		if field, ok := p.Value(v); ok {
+			item.Fields[p.String()] = fieldpath.FormatValue(field)
+		}
+	}
+	return f.filter(item), nil
+}
@@ -0,0 +1,118 @@
+package streamlister
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WithIntegrityCheck fails with IntegrityError instead of returning a list which is truncated or inconsistent
+// with its ListMeta. Every response must end at a field boundary and carry a ListMeta, the pages must share a
+// ResourceVersion, the RemainingItemCount of a page must match the items of the following pages, and the
+// last response must not have a continue token
+// unless ListOptions.Limit is set without WithPaging. Items skipped by WithFilter or WithDecodeErrorTolerance
+// count as received. StreamListFromReader and ReplayCapture expect their input to hold the whole list.
+func WithIntegrityCheck() OptionFunc {
+	return func(options *streamListOptions) {
+		options.integrityCheck = true
+	}
+}
+
+// IntegrityError is returned by WithIntegrityCheck when the received list can not be complete.
+type IntegrityError struct {
+	Reason string
+}
+
+func (e *IntegrityError) Error() string {
+	return "list integrity: " + e.Reason
+}
+
+// integrityChecker follows the responses of a single call, all methods are no-ops on nil.
+type integrityChecker struct {
+	// remaining is RemainingItemCount of the last response, nil if it is unknown.
+	remaining *int64
+	// resourceVersion is the ResourceVersion of the last response, empty if it is unknown.
+	resourceVersion string
+	continueToken   string
+	complete        bool
+}
+
+// integrityParam records what a single response carries.
+type integrityParam struct {
+	ParamWithErrorInterface
+	listMeta *metav1.ListMeta
+	ended    bool
+	items    int
+}
+
+func (p *integrityParam) OnListMeta(meta *metav1.ListMeta) error {
+	listMeta := *meta
+	p.listMeta = &listMeta
+	return p.ParamWithErrorInterface.OnListMeta(meta)
+}
+
+func (p *integrityParam) onListEnd(items int) error {
+	p.ended = true
+	p.items = items
+	return nil
+}
+
+// response checks a response which was decoded without error.
+func (c *integrityChecker) response(p *integrityParam) error {
+	if c == nil {
+		return nil
+	}
+	c.complete = false
+	if !p.ended {
+		return &IntegrityError{Reason: "response ended before the list"}
+	}
+	listMeta := p.listMeta
+	if listMeta == nil {
+		return &IntegrityError{Reason: "response has no ListMeta"}
+	}
+	if c.resourceVersion != "" && listMeta.ResourceVersion != c.resourceVersion {
+		return &IntegrityError{Reason: fmt.Sprintf("page has resourceVersion %q, but the previous page has %q",
+			listMeta.ResourceVersion, c.resourceVersion)}
+	}
+	remaining := listMeta.RemainingItemCount
+	if listMeta.Continue == "" {
+		if remaining != nil && *remaining != 0 {
+			return &IntegrityError{Reason: fmt.Sprintf("last page has %d remaining items", *remaining)}
+		}
+		var zero int64
+		remaining = &zero
+	}
+	if c.remaining != nil && remaining != nil && *c.remaining != int64(p.items)+*remaining {
+		return &IntegrityError{Reason: fmt.Sprintf("previous page has %d remaining items, but this page has %d items and %d remaining",
+			*c.remaining, p.items, *remaining)}
+	}
+	c.remaining = listMeta.RemainingItemCount
+	c.resourceVersion = listMeta.ResourceVersion
+	c.continueToken = listMeta.Continue
+	c.complete = true
+	return nil
+}
+
+// interrupted forgets the last response after a failed request, the next one is a resumed or restarted list.
+func (c *integrityChecker) interrupted() {
+	if c == nil {
+		return
+	}
+	c.remaining = nil
+	c.resourceVersion = ""
+	c.complete = false
+}
+
+// finish checks the last response once the call succeeded, allowContinue is set if a single page is asked for.
+func (c *integrityChecker) finish(allowContinue bool) error {
+	if c == nil {
+		return nil
+	}
+	if !c.complete {
+		return &IntegrityError{Reason: "last response is incomplete"}
+	}
+	if c.continueToken != "" && !allowContinue {
+		return &IntegrityError{Reason: "list ended with a continue token"}
+	}
+	return nil
+}
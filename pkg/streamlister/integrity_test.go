@@ -0,0 +1,95 @@
+package streamlister
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest/fake"
+)
+
+// pagesClient serves the JSON page of each continue token.
+func pagesClient(pages map[string]string) *fake.RESTClient {
+	return &fake.RESTClient{
+		GroupVersion:         schema.GroupVersion{Version: "v1"},
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		Client: fake.CreateHTTPClient(func(r *http.Request) (*http.Response, error) {
+			header := http.Header{}
+			header.Set("Content-Type", runtime.ContentTypeJSON)
+			body := pages[r.URL.Query().Get("continue")]
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: ioutil.NopCloser(bytes.NewReader([]byte(body)))}, nil
+		}),
+	}
+}
+
+func listWithIntegrityCheck(client *fake.RESTClient, opts ...OptionFunc) ([]string, error) {
+	var names []string
+	err := StreamListWithError(context.Background(), client, "pods", "", metav1.ListOptions{}, ParamWithErrorFuncs{
+		ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+		OnObjectFunc: func(o runtime.Object) error {
+			names = append(names, o.(*corev1.Pod).Name)
+			return nil
+		},
+	}, append(opts, WithIntegrityCheck())...)
+	return names, err
+}
+
+func checkIntegrityError(t *testing.T, err error, reason string) {
+	t.Helper()
+	var integrityErr *IntegrityError
+	if !errors.As(err, &integrityErr) {
+		t.Fatalf("got %v, want IntegrityError", err)
+	}
+	if integrityErr.Reason != reason {
+		t.Errorf("got reason %q, want %q", integrityErr.Reason, reason)
+	}
+}
+
+func TestIntegrityCheckTruncatedBody(t *testing.T) {
+	// The envelope ends at a field boundary before the list, which is a valid protobuf message.
+	unknown := runtime.Unknown{TypeMeta: runtime.TypeMeta{APIVersion: "v1", Kind: "PodList"}}
+	envelope, err := unknown.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := fakeClient(runtime.ContentTypeProtobuf, append([]byte("k8s\x00"), envelope...))
+	_, err = listWithIntegrityCheck(client)
+	checkIntegrityError(t, err, "response ended before the list")
+}
+
+func TestIntegrityCheckRemainingItemCount(t *testing.T) {
+	client := pagesClient(map[string]string{
+		"":  `{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"42","continue":"2","remainingItemCount":3},"items":[{"metadata":{"name":"a"}},{"metadata":{"name":"b"}}]}`,
+		"2": `{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"42"},"items":[{"metadata":{"name":"c"}},{"metadata":{"name":"d"}}]}`,
+	})
+	names, err := listWithIntegrityCheck(client, WithPaging(2))
+	checkIntegrityError(t, err, "previous page has 3 remaining items, but this page has 2 items and 0 remaining")
+	checkNames(t, names, []string{"a", "b", "c", "d"})
+}
+
+func TestIntegrityCheckResourceVersion(t *testing.T) {
+	client := pagesClient(map[string]string{
+		"":  `{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"42","continue":"2","remainingItemCount":2},"items":[{"metadata":{"name":"a"}},{"metadata":{"name":"b"}}]}`,
+		"2": `{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"43"},"items":[{"metadata":{"name":"c"}},{"metadata":{"name":"d"}}]}`,
+	})
+	_, err := listWithIntegrityCheck(client, WithPaging(2))
+	checkIntegrityError(t, err, `page has resourceVersion "43", but the previous page has "42"`)
+}
+
+func TestIntegrityCheckInconsistentContinue(t *testing.T) {
+	// The pages after the 410 Gone are served at a newer resourceVersion on purpose.
+	s := &pagingServer{pods: podNames(50), pageSize: 20, expireAt: map[int]bool{1: true}}
+	names, _, err := listPages(t, s, WithPaging(20), WithExpiredContinuePolicy(ExpiredContinueInconsistent), WithIntegrityCheck())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkNames(t, names, s.pods)
+}
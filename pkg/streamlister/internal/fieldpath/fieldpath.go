@@ -0,0 +1,158 @@
+// Package fieldpath resolves JSON field paths like "spec.nodeName" of API types to protobuf field numbers
+// and Go struct fields, using the struct tags generated for the API types.
+package fieldpath
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type Path struct {
+	// JSON holds the JSON names of each segment.
+	JSON []string
+	// Proto holds the protobuf field number of each segment.
+	Proto []int32
+	// Index holds the Go struct field index of each segment, embedded structs add more than one.
+	Index [][]int
+	// Type is the type of the last segment with pointers removed.
+	Type reflect.Type
+}
+
+func (p Path) String() string {
+	return strings.Join(p.JSON, ".")
+}
+
+// Resolve walks the struct t, or a pointer to it, along the dot separated JSON names of path.
+// Inlined embedded structs are searched as well. Every segment but the last one must be a struct.
+func Resolve(t reflect.Type, path string) (Path, error) {
+	p := Path{JSON: strings.Split(path, ".")}
+	t = indirect(t)
+	for i, name := range p.JSON {
+		if t.Kind() != reflect.Struct {
+			return Path{}, fmt.Errorf("field path %q: %s is not a struct", path, strings.Join(p.JSON[:i], "."))
+		}
+		field, ok := fieldByJSONName(t, name)
+		if !ok {
+			return Path{}, fmt.Errorf("field path %q: %s has no field %q", path, t, name)
+		}
+		num, err := protobufNumber(field.Tag.Get("protobuf"))
+		if err != nil {
+			return Path{}, fmt.Errorf("field path %q: %s.%s: %w", path, t, field.Name, err)
+		}
+		p.Proto = append(p.Proto, num)
+		p.Index = append(p.Index, field.Index)
+		t = indirect(field.Type)
+	}
+	p.Type = t
+	return p, nil
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func fieldByJSONName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+		if jsonName == name {
+			return field, true
+		}
+		if field.Anonymous && jsonName == "" && indirect(field.Type).Kind() == reflect.Struct {
+			if inner, ok := fieldByJSONName(indirect(field.Type), name); ok {
+				// Embedded structs without a protobuf tag are flattened into the outer message.
+				if field.Tag.Get("protobuf") == "" {
+					inner.Index = append(append([]int(nil), field.Index...), inner.Index...)
+					return inner, true
+				}
+			}
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// protobufNumber parses the field number of a tag like `protobuf:"bytes,10,opt,name=nodeName"`.
+func protobufNumber(tag string) (int32, error) {
+	parts := strings.Split(tag, ",")
+	if len(parts) < 2 {
+		return 0, fmt.Errorf("no protobuf tag")
+	}
+	num, err := strconv.ParseInt(parts[1], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid protobuf tag %q: %w", tag, err)
+	}
+	return int32(num), nil
+}
+
+// IsScalar reports whether values of t can be formatted by FormatValue and FormatVarint.
+func IsScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// Field returns the struct field at the path in v, false is returned if a pointer on the way is nil.
+func (p Path) Field(v reflect.Value) (reflect.Value, bool) {
+	for _, index := range p.Index {
+		for _, x := range index {
+			for v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return reflect.Value{}, false
+				}
+				v = v.Elem()
+			}
+			v = v.Field(x)
+		}
+	}
+	return v, true
+}
+
+// Value is like Field but follows pointers of the last segment, false is returned if any of them is nil.
+func (p Path) Value(v reflect.Value) (reflect.Value, bool) {
+	v, ok := p.Field(v)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	return v, true
+}
+
+// FormatValue formats a scalar value the same way as FormatVarint and string fields.
+func FormatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// FormatVarint formats a protobuf varint of a field of type t.
+func FormatVarint(t reflect.Type, varint uint64) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(varint != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(int64(varint), 10)
+	}
+	return strconv.FormatUint(varint, 10)
+}
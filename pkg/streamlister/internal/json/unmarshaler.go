@@ -2,20 +2,93 @@ package json
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"reflect"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kjson "sigs.k8s.io/json"
 
 	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/types"
 )
 
-func StreamUnmarshaler(r io.Reader, param types.ParamInterface) error {
+type ListStreamUnmarshaler struct {
+	// OnDecoded is called with the time spent decoding each item, always before its OnObject. Items are decoded
+	// while they are read unless OnItemError or OnStrictError is set, so the time includes reading them.
+	OnDecoded func(d time.Duration)
+	// OnItemError is called with the index and raw bytes of an item failing to decode, the item is skipped
+	// if it returns nil. Every item is read into memory before decoding if it is set.
+	OnItemError func(index int, raw []byte, err error) error
+	// Filter is called with each decoded item before OnObject, the item is skipped if it returns false.
+	// Errors of Filter are passed to OnItemError as well.
+	Filter func(obj runtime.Object) (bool, error)
+	// OnStrictError enables strict decoding, it is called with the unknown and duplicate fields of an item,
+	// which is still delivered if it returns nil. Every item is read into memory before decoding if it is set.
+	OnStrictError func(index int, raw []byte, errs []error) error
+	// MaxItemBytes and MaxItems fail the list with types.LimitExceededError, zero means no limit.
+	// Reading stops once an item exceeds MaxItemBytes, so it is never buffered as a whole.
+	MaxItemBytes int64
+	MaxItems     int
+	// OnListEnd is called once the closing brace of the list is read, with the number of items found
+	// including skipped ones.
+	OnListEnd func(items int) error
+}
+
+// separatorAllowance is read beyond MaxItemBytes for the comma and whitespace before an item.
+const separatorAllowance = 64
+
+var errAllowanceExceeded = errors.New("read allowance exceeded")
+
+// allowanceReader fails once more than limit bytes are read in total, a negative limit means no limit.
+type allowanceReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (a *allowanceReader) Read(p []byte) (int, error) {
+	if a.limit >= 0 {
+		if a.n >= a.limit {
+			return 0, errAllowanceExceeded
+		}
+		if int64(len(p)) > a.limit-a.n {
+			p = p[:a.limit-a.n]
+		}
+	}
+	n, err := a.r.Read(p)
+	a.n += int64(n)
+	return n, err
+}
+
+func StreamUnmarshaler(r io.Reader, param types.ParamWithErrorInterface) error {
+	return ListStreamUnmarshaler{}.Unmarshal(r, param)
+}
+
+func (u ListStreamUnmarshaler) Unmarshal(r io.Reader, param types.ParamWithErrorInterface) error {
 	var typeMeta metav1.TypeMeta
 	var apiVersionDecoded, kindDecoded bool
+	items := 0
+
+	var allowance *allowanceReader
+	if u.MaxItemBytes > 0 {
+		allowance = &allowanceReader{r: r, limit: -1}
+		r = allowance
+	}
+	// itemLimitErr converts the error of reading beyond the allowance of the item starting at itemStart.
+	var itemStart int64
+	itemLimitErr := func(err error) error {
+		if allowance != nil && errors.Is(err, errAllowanceExceeded) {
+			return &types.LimitExceededError{Limit: types.LimitMaxItemBytes, Max: u.MaxItemBytes, Actual: allowance.n - itemStart}
+		}
+		return err
+	}
 
-	dec := json.NewDecoder(r)
-	dec.UseNumber()
+	// Items are only buffered if their raw bytes may be passed to a hook.
+	buffered := u.OnItemError != nil || u.OnStrictError != nil
+	dec := kjson.NewDecoderCaseSensitivePreserveInts(r)
 	_, _ = dec.Token() // ignore `{`
 Loop:
 	for {
@@ -23,16 +96,19 @@ Loop:
 		if err != nil {
 			return fmt.Errorf("dec.Token: %w", err)
 		}
-		switch k {
-		case json.Delim('}'):
+		if isDelim(k, '}') {
 			break Loop
+		}
+		switch k {
 		case "apiVersion":
 			if err := dec.Decode(&typeMeta.APIVersion); err != nil {
 				return fmt.Errorf("decode apiVersion: %w", err)
 			}
 			apiVersionDecoded = true
 			if kindDecoded {
-				param.OnTypeMeta(&typeMeta)
+				if err := param.OnTypeMeta(&typeMeta); err != nil {
+					return fmt.Errorf("OnTypeMeta: %w", err)
+				}
 			}
 		case "kind":
 			if err := dec.Decode(&typeMeta.Kind); err != nil {
@@ -40,30 +116,99 @@ Loop:
 			}
 			kindDecoded = true
 			if apiVersionDecoded {
-				param.OnTypeMeta(&typeMeta)
+				if err := param.OnTypeMeta(&typeMeta); err != nil {
+					return fmt.Errorf("OnTypeMeta: %w", err)
+				}
 			}
 		case "metadata":
 			listMeta := &metav1.ListMeta{}
 			if err := dec.Decode(listMeta); err != nil {
 				return fmt.Errorf("decode metadata: %w", err)
 			}
-			param.OnListMeta(listMeta)
+			if err := param.OnListMeta(listMeta); err != nil {
+				return fmt.Errorf("OnListMeta: %w", err)
+			}
 		case "items":
 			if t, err := dec.Token(); err != nil {
 				return fmt.Errorf("decode items left bracket: %w", err)
-			} else if t != json.Delim('[') {
+			} else if !isDelim(t, '[') {
 				return fmt.Errorf("decode items but not array: %s", t)
 			}
-			for dec.More() {
+			for index := 0; ; index++ {
+				if allowance != nil {
+					itemStart = dec.InputOffset()
+					allowance.limit = itemStart + u.MaxItemBytes + separatorAllowance
+				}
+				if !dec.More() {
+					items += index
+					break
+				}
+				if u.MaxItems > 0 && index >= u.MaxItems {
+					return &types.LimitExceededError{Limit: types.LimitMaxItems, Max: int64(u.MaxItems), Actual: int64(index + 1)}
+				}
 				obj := param.ObjectFactory()
-				if err := dec.Decode(obj); err != nil {
-					return fmt.Errorf("decode item: %w", err)
+				var start time.Time
+				var raw json.RawMessage
+				var strictErrs []error
+				var decodeErr error
+				if buffered {
+					if err := dec.Decode(&raw); err != nil {
+						return fmt.Errorf("decode item: %w", itemLimitErr(err))
+					}
+					if u.OnDecoded != nil {
+						start = time.Now()
+					}
+					strictErrs, decodeErr = decodeRaw(raw, obj, u.OnStrictError != nil)
+				} else {
+					if u.OnDecoded != nil {
+						start = time.Now()
+					}
+					if err := dec.Decode(obj); err != nil {
+						return fmt.Errorf("decode item: %w", itemLimitErr(err))
+					}
+				}
+				if err := decodeErr; err != nil {
+					if u.OnItemError == nil {
+						return fmt.Errorf("decode item: %w", err)
+					}
+					if err := u.OnItemError(index, raw, err); err != nil {
+						return fmt.Errorf("decode item: %w", err)
+					}
+					continue
+				}
+				if len(strictErrs) > 0 {
+					if err := u.OnStrictError(index, raw, strictErrs); err != nil {
+						return fmt.Errorf("decode item: %w", err)
+					}
+				}
+				if u.OnDecoded != nil {
+					u.OnDecoded(time.Since(start))
+				}
+				if u.Filter != nil {
+					ok, err := u.Filter(obj)
+					if err != nil {
+						if u.OnItemError == nil {
+							return fmt.Errorf("Filter: %w", err)
+						}
+						if err := u.OnItemError(index, raw, err); err != nil {
+							return fmt.Errorf("Filter: %w", err)
+						}
+						continue
+					}
+					if !ok {
+						continue
+					}
 				}
-				param.OnObject(obj)
+				if err := param.OnObject(obj); err != nil {
+					return fmt.Errorf("OnObject: %w", err)
+				}
+			}
+			if allowance != nil {
+				allowance.limit = -1
 			}
 			if t, err := dec.Token(); err != nil {
-				return fmt.Errorf("decode items right bracket: %w", err)
-			} else if t != json.Delim(']') {
+				return fmt.Errorf("decode items right bracket: %w", itemLimitErr(err))
+			} else if !isDelim(t, ']') {
 				return fmt.Errorf("decode items but unexpected end: %s", t)
 			}
 		default:
@@ -74,7 +219,27 @@ Loop:
 		}
 	}
 	if !kindDecoded || !apiVersionDecoded {
-		param.OnTypeMeta(&typeMeta)
+		if err := param.OnTypeMeta(&typeMeta); err != nil {
+			return fmt.Errorf("OnTypeMeta: %w", err)
+		}
+	}
+	if u.OnListEnd != nil {
+		return u.OnListEnd(items)
 	}
 	return nil
 }
+
+// isDelim reports whether t is the delimiter d, the decoder of sigs.k8s.io/json returns its own Delim type.
+func isDelim(t interface{}, d rune) bool {
+	v := reflect.ValueOf(t)
+	return v.Kind() == reflect.Int32 && rune(v.Int()) == d
+}
+
+// decodeRaw decodes with the semantics of the apiserver serializer: field names are case-sensitive and
+// integers in untyped values are kept as int64. Unknown and duplicate fields are only reported when strict.
+func decodeRaw(raw json.RawMessage, obj interface{}, strict bool) ([]error, error) {
+	if strict {
+		return kjson.UnmarshalStrict(raw, obj, kjson.DisallowDuplicateFields, kjson.DisallowUnknownFields)
+	}
+	return nil, kjson.UnmarshalCaseSensitivePreserveInts(raw, obj)
+}
@@ -0,0 +1,165 @@
+package json
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/types"
+)
+
+// untypedItem has untyped fields, integers must be kept as int64.
+type untypedItem struct {
+	runtime.Object `json:"-"`
+	Int            interface{} `json:"int"`
+	Float          interface{} `json:"float"`
+}
+
+func TestListStreamUnmarshaler(t *testing.T) {
+	const body = `{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"7"},"items":[` +
+		`{"metadata":{"name":"a","Namespace":"wrong-case"},"spec":{"nodeName":"n"}},` +
+		`{"metadata":{"name":"b","name":"dup"},"unknown":1}` +
+		`]}`
+	tests := []struct {
+		name   string
+		strict bool
+		// tolerate sets OnItemError, which buffers items as well.
+		tolerate   bool
+		wantStrict map[int]int
+	}{
+		{name: "streamed"},
+		{name: "buffered", tolerate: true},
+		{name: "strict", strict: true, wantStrict: map[int]int{0: 1, 1: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pods []*corev1.Pod
+			var listMeta metav1.ListMeta
+			strictErrs := map[int]int{}
+			u := ListStreamUnmarshaler{}
+			if tt.tolerate {
+				u.OnItemError = func(index int, raw []byte, err error) error { return err }
+			}
+			if tt.strict {
+				u.OnStrictError = func(index int, raw []byte, errs []error) error {
+					strictErrs[index] = len(errs)
+					return nil
+				}
+			}
+			err := u.Unmarshal(strings.NewReader(body), types.ParamWithErrorFuncs{
+				ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+				OnListMetaFunc: func(meta *metav1.ListMeta) error {
+					listMeta = *meta
+					return nil
+				},
+				OnObjectFunc: func(o runtime.Object) error {
+					pods = append(pods, o.(*corev1.Pod))
+					return nil
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if listMeta.ResourceVersion != "7" {
+				t.Errorf("ListMeta got %+v", listMeta)
+			}
+			if len(pods) != 2 {
+				t.Fatalf("got %d items", len(pods))
+			}
+			// Field names are case-sensitive, and the last duplicate wins.
+			if pods[0].Name != "a" || pods[0].Namespace != "" || pods[0].Spec.NodeName != "n" || pods[1].Name != "dup" {
+				t.Errorf("items got %+v, %+v", pods[0].ObjectMeta, pods[1].ObjectMeta)
+			}
+			if tt.wantStrict == nil {
+				tt.wantStrict = map[int]int{}
+			}
+			if !reflect.DeepEqual(strictErrs, tt.wantStrict) {
+				t.Errorf("strict errors got %v, want %v", strictErrs, tt.wantStrict)
+			}
+		})
+	}
+}
+
+func TestListStreamUnmarshalerPreservesInts(t *testing.T) {
+	const body = `{"items":[{"int":9007199254740993,"float":1.5}]}`
+	for _, buffered := range []bool{false, true} {
+		u := ListStreamUnmarshaler{}
+		if buffered {
+			u.OnItemError = func(int, []byte, error) error { return nil }
+		}
+		var item *untypedItem
+		err := u.Unmarshal(strings.NewReader(body), types.ParamWithErrorFuncs{
+			ObjectFactoryFunc: func() runtime.Object { return &untypedItem{} },
+			OnObjectFunc: func(o runtime.Object) error {
+				item = o.(*untypedItem)
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := item.Int; got != int64(9007199254740993) {
+			t.Errorf("buffered=%v: int got %T %v", buffered, got, got)
+		}
+		if got := item.Float; got != 1.5 {
+			t.Errorf("buffered=%v: float got %T %v", buffered, got, got)
+		}
+	}
+}
+
+func TestListStreamUnmarshalerItemErrors(t *testing.T) {
+	const body = `{"items":[{"metadata":{"name":"a"}},{"metadata":{"name":1}},{"metadata":{"name":"c"}}]}`
+	param := func(names *[]string) types.ParamWithErrorFuncs {
+		return types.ParamWithErrorFuncs{
+			ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+			OnObjectFunc: func(o runtime.Object) error {
+				*names = append(*names, o.(*corev1.Pod).Name)
+				return nil
+			},
+		}
+	}
+
+	var names []string
+	if err := (ListStreamUnmarshaler{}).Unmarshal(strings.NewReader(body), param(&names)); err == nil {
+		t.Error("streamed: expected the error of the second item")
+	}
+
+	names = nil
+	var skipped []string
+	err := ListStreamUnmarshaler{
+		OnItemError: func(index int, raw []byte, err error) error {
+			skipped = append(skipped, string(raw))
+			return nil
+		},
+	}.Unmarshal(strings.NewReader(body), param(&names))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "c"}) || !reflect.DeepEqual(skipped, []string{`{"metadata":{"name":1}}`}) {
+		t.Errorf("items got %v, skipped %v", names, skipped)
+	}
+}
+
+func TestListStreamUnmarshalerMaxItemBytes(t *testing.T) {
+	body := `{"items":[{"metadata":{"name":"a"}},{"metadata":{"name":"` + strings.Repeat("x", 1000) + `"}}]}`
+	var names []string
+	err := ListStreamUnmarshaler{MaxItemBytes: 100}.Unmarshal(strings.NewReader(body), types.ParamWithErrorFuncs{
+		ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+		OnObjectFunc: func(o runtime.Object) error {
+			names = append(names, o.(*corev1.Pod).Name)
+			return nil
+		},
+	})
+	var limitErr *types.LimitExceededError
+	if !errors.As(err, &limitErr) || limitErr.Limit != types.LimitMaxItemBytes {
+		t.Fatalf("error got %v, want MaxItemBytes exceeded", err)
+	}
+	if !reflect.DeepEqual(names, []string{"a"}) {
+		t.Errorf("items got %v", names)
+	}
+}
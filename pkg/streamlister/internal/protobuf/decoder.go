@@ -0,0 +1,255 @@
+package protobuf
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/types"
+)
+
+type itemDecoder interface {
+	// decode takes the ownership of buf.
+	decode(buf []byte) error
+	// flush delivers all pending items.
+	flush() error
+}
+
+// itemErrorHook decides whether an item failing to unmarshal is skipped, raw is only valid during the call.
+type itemErrorHook func(index int, raw []byte, err error) error
+
+// itemFilter decides whether an item is unmarshalled at all.
+type itemFilter func(raw []byte) (bool, error)
+
+// itemPruner may rewrite raw in place before unmarshalling, it returns the new length.
+type itemPruner func(raw []byte) (int, error)
+
+// unmarshalItem prunes and unmarshals buf into obj. With keepRaw set, buf is left as received for the item
+// error hook and a copy is pruned instead.
+func unmarshalItem(obj runtime.Object, buf []byte, prune itemPruner, keepRaw bool) error {
+	if prune != nil {
+		if keepRaw {
+			pruned := getSlice(len(buf))
+			copy(pruned, buf)
+			defer ReleaseSlice(pruned)
+			buf = pruned
+		}
+		n, err := prune(buf)
+		if err != nil {
+			return err
+		}
+		buf = buf[:n]
+	}
+	return obj.(proto.Unmarshaler).Unmarshal(buf)
+}
+
+// filterItem returns false if the item is skipped, buf is released in that case.
+func filterItem(filter itemFilter, onItemError itemErrorHook, index int, buf []byte) (bool, error) {
+	if filter == nil {
+		return true, nil
+	}
+	ok, err := filter(buf)
+	if err != nil && onItemError != nil {
+		err = onItemError(index, buf, err)
+		ok = false
+	}
+	if err != nil || !ok {
+		ReleaseSlice(buf)
+	}
+	return ok, err
+}
+
+type sequentialDecoder struct {
+	param       types.ParamWithErrorInterface
+	onDecoded   func(d time.Duration)
+	onItemError itemErrorHook
+	filter      itemFilter
+	prune       itemPruner
+	index       int
+}
+
+func (d *sequentialDecoder) decode(buf []byte) error {
+	index := d.index
+	d.index++
+	if ok, err := filterItem(d.filter, d.onItemError, index, buf); !ok {
+		return err
+	}
+	obj := d.param.ObjectFactory()
+	var start time.Time
+	if d.onDecoded != nil {
+		start = time.Now()
+	}
+	err := unmarshalItem(obj, buf, d.prune, d.onItemError != nil)
+	if err != nil && d.onItemError != nil {
+		err = d.onItemError(index, buf, err)
+		ReleaseSlice(buf)
+		return err
+	}
+	ReleaseSlice(buf)
+	if err != nil {
+		return err
+	}
+	if d.onDecoded != nil {
+		d.onDecoded(time.Since(start))
+	}
+	if err := d.param.OnObject(obj); err != nil {
+		return fmt.Errorf("OnObject: %w", err)
+	}
+	return nil
+}
+
+func (d *sequentialDecoder) flush() error {
+	return nil
+}
+
+type decodeJob struct {
+	index   int
+	buf     []byte
+	obj     runtime.Object
+	err     error
+	elapsed time.Duration
+	done    chan struct{}
+}
+
+// parallelDecoder unmarshals items in a pool of workers, while ObjectFactory and callbacks are always
+// called from the goroutine reading the stream. At most 2*workers items are decoded or waiting for delivery.
+type parallelDecoder struct {
+	param       types.ParamWithErrorInterface
+	unordered   bool
+	maxInFlight int
+	onDecoded   func(d time.Duration)
+	onItemError itemErrorHook
+	filter      itemFilter
+	prune       itemPruner
+
+	index    int
+	jobs     chan *decodeJob
+	results  chan *decodeJob
+	pending  []*decodeJob
+	inFlight int
+	wg       sync.WaitGroup
+}
+
+func newParallelDecoder(workers int, unordered bool, param types.ParamWithErrorInterface, onDecoded func(d time.Duration), onItemError itemErrorHook, filter itemFilter, prune itemPruner) *parallelDecoder {
+	maxInFlight := 2 * workers
+	d := &parallelDecoder{
+		param:       param,
+		unordered:   unordered,
+		maxInFlight: maxInFlight,
+		onDecoded:   onDecoded,
+		onItemError: onItemError,
+		filter:      filter,
+		prune:       prune,
+		jobs:        make(chan *decodeJob, maxInFlight),
+	}
+	if unordered {
+		d.results = make(chan *decodeJob, maxInFlight)
+	}
+	d.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+	return d
+}
+
+func (d *parallelDecoder) work() {
+	defer d.wg.Done()
+	for job := range d.jobs {
+		var start time.Time
+		if d.onDecoded != nil {
+			start = time.Now()
+		}
+		job.err = unmarshalItem(job.obj, job.buf, d.prune, d.onItemError != nil)
+		if d.onDecoded != nil {
+			job.elapsed = time.Since(start)
+		}
+		// Keep the raw bytes of a failed item for onItemError.
+		if job.err == nil || d.onItemError == nil {
+			ReleaseSlice(job.buf)
+			job.buf = nil
+		}
+		if d.unordered {
+			d.results <- job
+		} else {
+			close(job.done)
+		}
+	}
+}
+
+func (d *parallelDecoder) decode(buf []byte) error {
+	index := d.index
+	d.index++
+	// Filtering runs on the reading goroutine, only matching items are handed to workers.
+	if ok, err := filterItem(d.filter, d.onItemError, index, buf); !ok {
+		return err
+	}
+	if d.inFlight >= d.maxInFlight {
+		if err := d.deliverOne(); err != nil {
+			return err
+		}
+	}
+	job := &decodeJob{
+		index: index,
+		buf:   buf,
+		obj:   d.param.ObjectFactory(),
+	}
+	if !d.unordered {
+		job.done = make(chan struct{})
+		d.pending = append(d.pending, job)
+	}
+	d.inFlight++
+	// Never blocks since the channel can hold maxInFlight jobs.
+	d.jobs <- job
+	return nil
+}
+
+func (d *parallelDecoder) deliverOne() error {
+	var job *decodeJob
+	if d.unordered {
+		job = <-d.results
+	} else {
+		job = d.pending[0]
+		d.pending[0] = nil
+		d.pending = d.pending[1:]
+		<-job.done
+	}
+	d.inFlight--
+	if job.err != nil {
+		if job.buf == nil {
+			return job.err
+		}
+		err := d.onItemError(job.index, job.buf, job.err)
+		ReleaseSlice(job.buf)
+		return err
+	}
+	if d.onDecoded != nil {
+		d.onDecoded(job.elapsed)
+	}
+	if err := d.param.OnObject(job.obj); err != nil {
+		return fmt.Errorf("OnObject: %w", err)
+	}
+	return nil
+}
+
+func (d *parallelDecoder) flush() error {
+	for d.inFlight > 0 {
+		if err := d.deliverOne(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stop waits for all workers to exit, undelivered items are dropped.
+func (d *parallelDecoder) stop() {
+	close(d.jobs)
+	d.wg.Wait()
+	for _, job := range d.pending {
+		if job.buf != nil {
+			ReleaseSlice(job.buf)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package protobuf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/types"
+)
+
+// appendField appends a length-delimited field to a wire-encoded message.
+func appendField(dAtA []byte, num int32, value []byte) []byte {
+	var header [2 * binary.MaxVarintLen64]byte
+	h := binary.PutUvarint(header[:], uint64(num)<<3|2)
+	h += binary.PutUvarint(header[h:], uint64(len(value)))
+	return append(append(dAtA, header[:h]...), value...)
+}
+
+// podListFixture encodes a PodList of the given items, a name starting with "!" is encoded as an item
+// which fails to unmarshal.
+func podListFixture(t testing.TB, names ...string) []byte {
+	listMeta, err := (&metav1.ListMeta{ResourceVersion: "1"}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dAtA := appendField(nil, 1, listMeta)
+	for _, name := range names {
+		if name[0] == '!' {
+			// ObjectMeta claims more bytes than the item holds.
+			dAtA = appendField(dAtA, 2, []byte{0x0a, 0x05, 0x0a})
+			continue
+		}
+		pod, err := (&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}}).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dAtA = appendField(dAtA, 2, pod)
+	}
+	return dAtA
+}
+
+func TestListStreamUnmarshalerDecoders(t *testing.T) {
+	errOnObject := errors.New("on object")
+	names := make([]string, 50)
+	for i := range names {
+		names[i] = fmt.Sprintf("pod-%02d", i)
+	}
+	withBad := append(append(append([]string(nil), names[:10]...), "!bad"), names[10:]...)
+
+	tests := []struct {
+		name      string
+		items     []string
+		unordered bool
+		// skipErrors sets OnItemError to skip failed items.
+		skipErrors  bool
+		failOnObjAt string
+		want        []string
+		wantSkipped []int
+		wantErr     error
+	}{
+		{name: "ordered", items: names, want: names},
+		{name: "unordered", items: names, unordered: true, want: names},
+		{name: "item error", items: withBad, want: names[:10], wantErr: io.ErrUnexpectedEOF},
+		{name: "item error skipped", items: withBad, skipErrors: true, want: names, wantSkipped: []int{10}},
+		{name: "item error skipped unordered", items: withBad, unordered: true, skipErrors: true, want: names, wantSkipped: []int{10}},
+		{name: "OnObject error", items: names, failOnObjAt: "pod-20", want: names[:20], wantErr: errOnObject},
+	}
+	for _, tt := range tests {
+		for _, workers := range []int{1, 4} {
+			t.Run(fmt.Sprintf("%s/workers=%d", tt.name, workers), func(t *testing.T) {
+				if tt.unordered && workers == 1 {
+					t.Skip("unordered delivery needs workers")
+				}
+				dAtA := podListFixture(t, tt.items...)
+				var got []string
+				var skipped []int
+				u := ListStreamUnmarshaler{Workers: workers, Unordered: tt.unordered}
+				if tt.skipErrors {
+					u.OnItemError = func(index int, raw []byte, err error) error {
+						if len(raw) == 0 {
+							t.Errorf("item %d: empty raw", index)
+						}
+						skipped = append(skipped, index)
+						return nil
+					}
+				}
+				err := u.Unmarshal(NewStreamBuffer(bytes.NewReader(dAtA), len(dAtA)), types.ParamWithErrorFuncs{
+					ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+					OnObjectFunc: func(o runtime.Object) error {
+						name := o.(*corev1.Pod).Name
+						if name == tt.failOnObjAt {
+							return errOnObject
+						}
+						got = append(got, name)
+						return nil
+					},
+				})
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error got %v, want %v", err, tt.wantErr)
+				}
+				if tt.unordered {
+					sort.Strings(got)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("items got %v, want %v", got, tt.want)
+				}
+				if !reflect.DeepEqual(skipped, tt.wantSkipped) {
+					t.Errorf("skipped got %v, want %v", skipped, tt.wantSkipped)
+				}
+			})
+		}
+	}
+}
+
+func TestListStreamUnmarshalerItemErrorRawWithPrune(t *testing.T) {
+	bad := []byte{0x0a, 0x05, 0x0a}
+	dAtA := appendField(podListFixture(t, "a"), 2, bad)
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			var raws [][]byte
+			err := ListStreamUnmarshaler{
+				Workers: workers,
+				OnItemError: func(index int, raw []byte, err error) error {
+					raws = append(raws, append([]byte(nil), raw...))
+					return nil
+				},
+				// Overwrites the item, it must not be visible to OnItemError.
+				Prune: func(raw []byte) (int, error) {
+					for i := range raw {
+						raw[i] = 0xff
+					}
+					return len(raw), nil
+				},
+			}.Unmarshal(NewStreamBuffer(bytes.NewReader(dAtA), len(dAtA)), types.ParamWithErrorFuncs{
+				ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+				OnObjectFunc:      func(runtime.Object) error { return nil },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The pruned valid item fails as well, only the raw bytes are compared.
+			if len(raws) != 2 || !bytes.Equal(raws[1], bad) {
+				t.Errorf("OnItemError raw got %x, want %x last", raws, bad)
+			}
+		})
+	}
+}
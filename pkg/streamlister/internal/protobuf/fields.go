@@ -0,0 +1,154 @@
+package protobuf
+
+import (
+	"fmt"
+	"io"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Field is a field of a message held in memory.
+type Field struct {
+	Num      int32
+	WireType int
+	// Varint is the value of a varint, fixed32 or fixed64 field.
+	Varint uint64
+	// Bytes is the value of a length-delimited field, or the content of a group.
+	Bytes []byte
+	// Start and End are the offsets of the whole field including its tag.
+	Start int
+	End   int
+}
+
+// NextField reads the field starting at iNdEx of dAtA.
+func NextField(dAtA []byte, iNdEx int) (Field, error) {
+	f := Field{Start: iNdEx}
+	wire, iNdEx, err := readVarint(dAtA, iNdEx)
+	if err != nil {
+		return f, err
+	}
+	f.Num = int32(wire >> 3)
+	f.WireType = int(wire & 0x7)
+	if f.Num <= 0 {
+		return f, fmt.Errorf("proto: illegal tag %d (wire type %d)", f.Num, wire)
+	}
+	switch f.WireType {
+	case 0:
+		f.Varint, iNdEx, err = readVarint(dAtA, iNdEx)
+		if err != nil {
+			return f, err
+		}
+	case 1:
+		if iNdEx+8 > len(dAtA) {
+			return f, io.ErrUnexpectedEOF
+		}
+		for i := 7; i >= 0; i-- {
+			f.Varint = f.Varint<<8 | uint64(dAtA[iNdEx+i])
+		}
+		iNdEx += 8
+	case 5:
+		if iNdEx+4 > len(dAtA) {
+			return f, io.ErrUnexpectedEOF
+		}
+		for i := 3; i >= 0; i-- {
+			f.Varint = f.Varint<<8 | uint64(dAtA[iNdEx+i])
+		}
+		iNdEx += 4
+	case 2:
+		var length uint64
+		length, iNdEx, err = readVarint(dAtA, iNdEx)
+		if err != nil {
+			return f, err
+		}
+		postIndex := iNdEx + int(length)
+		if int(length) < 0 || postIndex < 0 {
+			return f, runtime.ErrInvalidLengthGenerated
+		}
+		if postIndex > len(dAtA) {
+			return f, io.ErrUnexpectedEOF
+		}
+		f.Bytes = dAtA[iNdEx:postIndex]
+		iNdEx = postIndex
+	case 3:
+		start := iNdEx
+		for {
+			inner, err := NextField(dAtA, iNdEx)
+			if err == errEndGroup {
+				f.Bytes = dAtA[start:iNdEx]
+				iNdEx = inner.End
+				break
+			}
+			if err != nil {
+				return f, err
+			}
+			iNdEx = inner.End
+		}
+	case 4:
+		f.End = iNdEx
+		return f, errEndGroup
+	default:
+		return f, fmt.Errorf("proto: illegal wireType %d", f.WireType)
+	}
+	f.End = iNdEx
+	return f, nil
+}
+
+var errEndGroup = runtime.ErrUnexpectedEndOfGroupGenerated
+
+func readVarint(dAtA []byte, iNdEx int) (uint64, int, error) {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		if shift >= 64 {
+			return 0, 0, runtime.ErrIntOverflowGenerated
+		}
+		if iNdEx >= len(dAtA) {
+			return 0, 0, io.ErrUnexpectedEOF
+		}
+		b := dAtA[iNdEx]
+		iNdEx++
+		v |= uint64(b&0x7F) << shift
+		if b < 0x80 {
+			return v, iNdEx, nil
+		}
+	}
+}
+
+// ScanFields calls visit for every field of dAtA found at one of paths, which are field numbers from the top
+// level message. Only length-delimited fields on the way to a path are descended.
+func ScanFields(dAtA []byte, paths [][]int32, visit func(path int, field Field) error) error {
+	candidates := make([]int, len(paths))
+	for i := range paths {
+		candidates[i] = i
+	}
+	return scanFields(dAtA, paths, candidates, 0, visit)
+}
+
+func scanFields(dAtA []byte, paths [][]int32, candidates []int, depth int, visit func(path int, field Field) error) error {
+	var nested []int
+	for iNdEx := 0; iNdEx < len(dAtA); {
+		f, err := NextField(dAtA, iNdEx)
+		if err != nil {
+			return err
+		}
+		iNdEx = f.End
+		nested = nested[:0]
+		for _, i := range candidates {
+			if paths[i][depth] != f.Num {
+				continue
+			}
+			if len(paths[i]) == depth+1 {
+				if err := visit(i, f); err != nil {
+					return err
+				}
+			} else if f.WireType == 2 {
+				nested = append(nested, i)
+			}
+		}
+		if len(nested) > 0 {
+			if err := scanFields(f.Bytes, paths, append([]int(nil), nested...), depth+1, visit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
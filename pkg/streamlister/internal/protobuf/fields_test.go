@@ -0,0 +1,85 @@
+package protobuf
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func fixturePod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "a",
+			Namespace:   "default",
+			Labels:      map[string]string{"app": "x", "tier": "web"},
+			Annotations: map[string]string{"big": "yyyyyyyyyyyyyyyyyyyyyyyyyyyyyy", "small": "z"},
+			ManagedFields: []metav1.ManagedFieldsEntry{
+				{Manager: "kubectl", Operation: metav1.ManagedFieldsOperationApply},
+				{Manager: "kubelet", Operation: metav1.ManagedFieldsOperationUpdate},
+			},
+		},
+		Spec:   corev1.PodSpec{NodeName: "node-1"},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func marshalPod(t *testing.T, pod *corev1.Pod) []byte {
+	dAtA, err := pod.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dAtA
+}
+
+func TestScanFields(t *testing.T) {
+	dAtA := marshalPod(t, fixturePod())
+	tests := []struct {
+		name  string
+		paths [][]int32
+		want  map[int][]string
+	}{
+		{name: "name", paths: [][]int32{{1, 1}}, want: map[int][]string{0: {"a"}}},
+		{
+			name:  "nested messages",
+			paths: [][]int32{{1, 3}, {2, 10}, {3, 1}},
+			want:  map[int][]string{0: {"default"}, 1: {"node-1"}, 2: {"Running"}},
+		},
+		// Every entry of a map is a field of its own, only the key is compared here.
+		{name: "map", paths: [][]int32{{1, 11}}, want: map[int][]string{0: {"app", "tier"}}},
+		{name: "same prefix", paths: [][]int32{{1, 1}, {1, 3}}, want: map[int][]string{0: {"a"}, 1: {"default"}}},
+		{name: "missing", paths: [][]int32{{1, 99}, {9}}, want: map[int][]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[int][]string{}
+			err := ScanFields(dAtA, tt.paths, func(path int, field Field) error {
+				value := field.Bytes
+				if tt.name == "map" {
+					key, err := mapEntryKey(field.Bytes)
+					if err != nil {
+						return err
+					}
+					value = key
+				}
+				got[path] = append(got[path], string(value))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanFieldsTruncated(t *testing.T) {
+	dAtA := marshalPod(t, fixturePod())
+	err := ScanFields(dAtA[:len(dAtA)-1], [][]int32{{3, 1}}, func(int, Field) error { return nil })
+	if err == nil {
+		t.Fatal("expected an error for a truncated message")
+	}
+}
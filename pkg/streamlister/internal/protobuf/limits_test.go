@@ -0,0 +1,92 @@
+package protobuf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/types"
+)
+
+// oversized is the length claimed by the field under test, far more than a test can allocate.
+const oversized = 1 << 40
+
+// fieldHeader encodes the tag and length prefix of a length-delimited field without its value.
+func fieldHeader(num int32, length uint64) []byte {
+	var header [2 * binary.MaxVarintLen64]byte
+	h := binary.PutUvarint(header[:], uint64(num)<<3|2)
+	h += binary.PutUvarint(header[h:], length)
+	return header[:h]
+}
+
+// headerOnlyStream returns a stream of unknown length which fails the test if anything after data is read.
+func headerOnlyStream(t *testing.T, data []byte) *StreamBuffer {
+	return NewStreamBuffer(io.MultiReader(bytes.NewReader(data), failReader{t: t}), -1)
+}
+
+type failReader struct {
+	t *testing.T
+}
+
+func (r failReader) Read([]byte) (int, error) {
+	r.t.Error("read past the length prefix")
+	return 0, io.ErrUnexpectedEOF
+}
+
+func checkLimitExceeded(t *testing.T, err error, limit types.Limit, max int64) {
+	t.Helper()
+	var limitErr *types.LimitExceededError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("got %v, want LimitExceededError", err)
+	}
+	if limitErr.Limit != limit || limitErr.Max != max || limitErr.Actual != oversized {
+		t.Errorf("got %+v, want %s of %d exceeded by %d", limitErr, limit, max, int64(oversized))
+	}
+}
+
+func TestListStreamUnmarshalerLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		u     ListStreamUnmarshaler
+		field int32
+		limit types.Limit
+		max   int64
+	}{
+		{name: "item over MaxItemBytes", u: ListStreamUnmarshaler{MaxItemBytes: 1 << 20}, field: 2, limit: types.LimitMaxItemBytes, max: 1 << 20},
+		{name: "item over MaxResponseBytes", u: ListStreamUnmarshaler{MaxResponseBytes: 1 << 20}, field: 2, limit: types.LimitMaxResponseBytes, max: 1 << 20},
+		{name: "ListMeta over MaxResponseBytes", u: ListStreamUnmarshaler{MaxResponseBytes: 1 << 20}, field: 1, limit: types.LimitMaxResponseBytes, max: 1 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := podListFixture(t, "a")
+			data = append(data, fieldHeader(tt.field, oversized)...)
+			var names []string
+			param := types.ParamWithErrorFuncs{
+				ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+				OnObjectFunc: func(o runtime.Object) error {
+					names = append(names, o.(*corev1.Pod).Name)
+					return nil
+				},
+			}
+			err := tt.u.Unmarshal(headerOnlyStream(t, data), param)
+			checkLimitExceeded(t, err, tt.limit, tt.max)
+			if len(names) != 1 {
+				t.Errorf("got %d items before the oversized field, want 1", len(names))
+			}
+		})
+	}
+}
+
+func TestUnknownStreamUnmarshalerLimits(t *testing.T) {
+	for name, field := range map[string]int32{"TypeMeta": 1, "ContentEncoding": 3, "ContentType": 4} {
+		t.Run(name, func(t *testing.T) {
+			err := UnknownStreamUnmarshaler{MaxResponseBytes: 1 << 20}.Unmarshal(headerOnlyStream(t, fieldHeader(field, oversized)))
+			checkLimitExceeded(t, err, types.LimitMaxResponseBytes, 1<<20)
+		})
+	}
+}
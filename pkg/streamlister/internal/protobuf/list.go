@@ -3,30 +3,83 @@ package protobuf
 import (
 	"fmt"
 	"io"
+	"time"
 
-	"github.com/gogo/protobuf/proto"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/types"
 )
 
-func UnmarshalListStream(dAtA *StreamBuffer, param types.ParamInterface) error {
+type ListStreamUnmarshaler struct {
+	// Workers decodes items concurrently when it is greater than 1.
+	Workers int
+	// Unordered delivers items as soon as they are decoded instead of in the list order, only used with Workers.
+	Unordered bool
+	// OnUnknownField is called for fields other than metadata and items, they are skipped.
+	OnUnknownField func(fieldNum int32, wireType int)
+	// OnDecoded is called with the time spent unmarshalling each item, always before its OnObject.
+	OnDecoded func(d time.Duration)
+	// OnItemError is called with the index and raw bytes of an item failing to unmarshal, the item is skipped
+	// if it returns nil. raw is the item as received even with Prune, and only valid during the call.
+	OnItemError func(index int, raw []byte, err error) error
+	// Filter is called with the raw bytes of each item before unmarshalling, the item is skipped if it returns false.
+	// Errors of Filter are passed to OnItemError as well.
+	Filter func(raw []byte) (bool, error)
+	// Prune may remove fields from the raw bytes of each item in place before unmarshalling, it returns
+	// the new length. It is called from the workers when Workers is greater than 1. A copy is pruned if
+	// OnItemError is set.
+	Prune func(raw []byte) (int, error)
+	// MaxItemBytes, MaxItems and MaxResponseBytes fail the list with types.LimitExceededError before
+	// allocating a field exceeding them, zero means no limit.
+	MaxItemBytes     int
+	MaxItems         int
+	MaxResponseBytes int
+	// OnListEnd is called once the list ended at a field boundary and every item is delivered, with the number
+	// of items found including skipped ones.
+	OnListEnd func(items int) error
+}
+
+// checkFieldLen fails if a length-delimited field can not fit in a response.
+func (u ListStreamUnmarshaler) checkFieldLen(msglen int) error {
+	if u.MaxResponseBytes > 0 && msglen > u.MaxResponseBytes {
+		return &types.LimitExceededError{Limit: types.LimitMaxResponseBytes, Max: int64(u.MaxResponseBytes), Actual: int64(msglen)}
+	}
+	return nil
+}
+
+func UnmarshalListStream(dAtA *StreamBuffer, param types.ParamWithErrorInterface) error {
+	return ListStreamUnmarshaler{}.Unmarshal(dAtA, param)
+}
+
+func (u ListStreamUnmarshaler) Unmarshal(dAtA *StreamBuffer, param types.ParamWithErrorInterface) error {
+	var decoder itemDecoder = &sequentialDecoder{param: param, onDecoded: u.OnDecoded, onItemError: u.OnItemError, filter: u.Filter, prune: u.Prune}
+	if u.Workers > 1 {
+		parallel := newParallelDecoder(u.Workers, u.Unordered, param, u.OnDecoded, u.OnItemError, u.Filter, u.Prune)
+		defer parallel.stop()
+		decoder = parallel
+	}
+
+	// l is negative when the length is unknown, e.g. the list is decompressed on the fly.
 	l := dAtA.Len()
 	iNdEx := 0
+	items := 0
 Loop:
-	for iNdEx < l {
+	for l < 0 || iNdEx < l {
 		var wire uint64
 		for shift := uint(0); ; shift += 7 {
 			if shift >= 64 {
 				return corev1.ErrIntOverflowGenerated
 			}
-			if iNdEx >= l {
+			if l >= 0 && iNdEx >= l {
 				return io.ErrUnexpectedEOF
 			}
 			b, err := dAtA.Get(iNdEx)
 			if err != nil {
-				return err
+				if l < 0 && shift == 0 && err == io.EOF {
+					break Loop
+				}
+				return unexpectedEOF(err)
 			}
 			iNdEx++
 			wire |= uint64(b&0x7F) << shift
@@ -52,12 +105,12 @@ Loop:
 				if shift >= 64 {
 					return corev1.ErrIntOverflowGenerated
 				}
-				if iNdEx >= l {
+				if l >= 0 && iNdEx >= l {
 					return io.ErrUnexpectedEOF
 				}
 				b, err := dAtA.Get(iNdEx)
 				if err != nil {
-					return err
+					return unexpectedEOF(err)
 				}
 				iNdEx++
 				msglen |= int(b&0x7F) << shift
@@ -72,18 +125,28 @@ Loop:
 			if postIndex < 0 {
 				return corev1.ErrInvalidLengthGenerated
 			}
-			if postIndex > l {
+			if l >= 0 && postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
+			if err := u.checkFieldLen(msglen); err != nil {
+				return err
+			}
 			buf, err := dAtA.Slice(iNdEx, postIndex)
 			if err != nil {
-				return err
+				return unexpectedEOF(err)
 			}
 			var listMeta metav1.ListMeta
-			if err := listMeta.Unmarshal(buf); err != nil {
+			err = listMeta.Unmarshal(buf)
+			ReleaseSlice(buf)
+			if err != nil {
+				return err
+			}
+			if err := decoder.flush(); err != nil {
 				return err
 			}
-			param.OnListMeta(&listMeta)
+			if err := param.OnListMeta(&listMeta); err != nil {
+				return fmt.Errorf("OnListMeta: %w", err)
+			}
 			iNdEx = postIndex
 		case 2:
 			if wireType != 2 {
@@ -94,12 +157,12 @@ Loop:
 				if shift >= 64 {
 					return corev1.ErrIntOverflowGenerated
 				}
-				if iNdEx >= l {
+				if l >= 0 && iNdEx >= l {
 					return io.ErrUnexpectedEOF
 				}
 				b, err := dAtA.Get(iNdEx)
 				if err != nil {
-					return err
+					return unexpectedEOF(err)
 				}
 				iNdEx++
 				msglen |= int(b&0x7F) << shift
@@ -114,29 +177,47 @@ Loop:
 			if postIndex < 0 {
 				return corev1.ErrInvalidLengthGenerated
 			}
-			if postIndex > l {
+			if l >= 0 && postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
+			items++
+			if u.MaxItems > 0 && items > u.MaxItems {
+				return &types.LimitExceededError{Limit: types.LimitMaxItems, Max: int64(u.MaxItems), Actual: int64(items)}
+			}
+			if u.MaxItemBytes > 0 && msglen > u.MaxItemBytes {
+				return &types.LimitExceededError{Limit: types.LimitMaxItemBytes, Max: int64(u.MaxItemBytes), Actual: int64(msglen)}
+			}
+			if err := u.checkFieldLen(msglen); err != nil {
+				return err
+			}
 			buf, err := dAtA.Slice(iNdEx, postIndex)
 			if err != nil {
-				return err
+				return unexpectedEOF(err)
 			}
-			obj := param.ObjectFactory()
-			if err := obj.(proto.Unmarshaler).Unmarshal(buf); err != nil {
+			if err := decoder.decode(buf); err != nil {
 				return err
 			}
-			param.OnObject(obj)
 			iNdEx = postIndex
 		default:
-			if err := dAtA.Discard(); err != nil {
+			if u.OnUnknownField != nil {
+				u.OnUnknownField(fieldNum, wireType)
+			}
+			postIndex, err := skipField(dAtA, iNdEx, l, wireType)
+			if err != nil {
 				return err
 			}
-			break Loop
+			iNdEx = postIndex
 		}
 	}
 
-	if iNdEx > l {
+	if l >= 0 && iNdEx > l {
 		return io.ErrUnexpectedEOF
 	}
+	if err := decoder.flush(); err != nil {
+		return err
+	}
+	if u.OnListEnd != nil {
+		return u.OnListEnd(items)
+	}
 	return nil
 }
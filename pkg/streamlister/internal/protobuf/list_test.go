@@ -0,0 +1,75 @@
+package protobuf
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/types"
+)
+
+var (
+	benchPodListOnce sync.Once
+	benchPodList     []byte
+)
+
+// benchmarkPodList returns a wire-encoded PodList of 100k pods, built once.
+func benchmarkPodList(b *testing.B) []byte {
+	benchPodListOnce.Do(func() {
+		list := &corev1.PodList{ListMeta: metav1.ListMeta{ResourceVersion: "1"}}
+		for i := 0; i < 100000; i++ {
+			list.Items = append(list.Items, corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("pod-%d", i),
+					Namespace: fmt.Sprintf("ns-%d", i%100),
+					UID:       "00000000-0000-0000-0000-000000000000",
+					Labels:    map[string]string{"app": "bench", "pod-template-hash": "5d4f8c7b9"},
+				},
+				Spec: corev1.PodSpec{
+					NodeName: fmt.Sprintf("node-%d", i%1000),
+					Containers: []corev1.Container{{
+						Name:  "main",
+						Image: "registry.example.com/bench:v1",
+						Args:  []string{"--port=8080", "--verbose"},
+					}},
+				},
+				Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "10.0.0.1"},
+			})
+		}
+		data, err := list.Marshal()
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchPodList = data
+	})
+	if benchPodList == nil {
+		b.Fatal("PodList fixture failed to build")
+	}
+	return benchPodList
+}
+
+func BenchmarkListStreamUnmarshaler(b *testing.B) {
+	data := benchmarkPodList(b)
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			param := types.ParamWithErrorFuncs{
+				ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+				OnObjectFunc:      func(runtime.Object) error { return nil },
+			}
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err := ListStreamUnmarshaler{Workers: workers}.Unmarshal(NewStreamBuffer(bytes.NewReader(data), len(data)), param)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package protobuf
+
+import (
+	"encoding/binary"
+)
+
+// PrunePath is a path of field numbers from the top level message to a field to be removed.
+type PrunePath struct {
+	Fields []int32
+	// MapKey removes only the entry with this key if the last field is a map.
+	MapKey string
+}
+
+// PruneFields removes the fields at paths from the message dAtA in place, and returns its new length.
+// Messages on the way to a path are re-encoded with their new length.
+func PruneFields(dAtA []byte, paths []PrunePath) (int, error) {
+	candidates := make([]int, len(paths))
+	for i := range paths {
+		candidates[i] = i
+	}
+	return pruneFields(dAtA, paths, candidates, 0)
+}
+
+func pruneFields(dAtA []byte, paths []PrunePath, candidates []int, depth int) (int, error) {
+	w := 0
+	var nested []int
+	for iNdEx := 0; iNdEx < len(dAtA); {
+		f, err := NextField(dAtA, iNdEx)
+		if err != nil {
+			return 0, err
+		}
+		iNdEx = f.End
+
+		drop := false
+		nested = nested[:0]
+		for _, i := range candidates {
+			p := paths[i]
+			if p.Fields[depth] != f.Num {
+				continue
+			}
+			if len(p.Fields) > depth+1 {
+				if f.WireType == 2 {
+					nested = append(nested, i)
+				}
+				continue
+			}
+			if p.MapKey == "" {
+				drop = true
+				break
+			}
+			if f.WireType != 2 {
+				continue
+			}
+			key, err := mapEntryKey(f.Bytes)
+			if err != nil {
+				return 0, err
+			}
+			if string(key) == p.MapKey {
+				drop = true
+				break
+			}
+		}
+		if drop {
+			continue
+		}
+		if len(nested) == 0 {
+			// w never passes f.Start since the output is never longer than the input.
+			w += copy(dAtA[w:], dAtA[f.Start:f.End])
+			continue
+		}
+
+		contentStart := f.End - len(f.Bytes)
+		n, err := pruneFields(dAtA[contentStart:f.End], paths, append([]int(nil), nested...), depth+1)
+		if err != nil {
+			return 0, err
+		}
+		// The new header is never longer than the old one, so it does not overlap the content.
+		var header [2 * binary.MaxVarintLen64]byte
+		h := binary.PutUvarint(header[:], uint64(f.Num)<<3|2)
+		h += binary.PutUvarint(header[h:], uint64(n))
+		w += copy(dAtA[w:], header[:h])
+		w += copy(dAtA[w:], dAtA[contentStart:contentStart+n])
+	}
+	return w, nil
+}
+
+// mapEntryKey returns the key of a map entry, which is always field 1.
+func mapEntryKey(dAtA []byte) ([]byte, error) {
+	for iNdEx := 0; iNdEx < len(dAtA); {
+		f, err := NextField(dAtA, iNdEx)
+		if err != nil {
+			return nil, err
+		}
+		if f.Num == 1 && f.WireType == 2 {
+			return f.Bytes, nil
+		}
+		iNdEx = f.End
+	}
+	return nil, nil
+}
@@ -0,0 +1,93 @@
+package protobuf
+
+import (
+	"bytes"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestPruneFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []PrunePath
+		// edit applies the expected pruning on the fixture.
+		edit func(pod *corev1.Pod)
+	}{
+		{
+			name:  "managedFields",
+			paths: []PrunePath{{Fields: []int32{1, 17}}},
+			edit:  func(pod *corev1.Pod) { pod.ManagedFields = nil },
+		},
+		{
+			name:  "map entry",
+			paths: []PrunePath{{Fields: []int32{1, 12}, MapKey: "big"}},
+			edit:  func(pod *corev1.Pod) { delete(pod.Annotations, "big") },
+		},
+		{
+			name:  "whole map",
+			paths: []PrunePath{{Fields: []int32{1, 11}}},
+			edit:  func(pod *corev1.Pod) { pod.Labels = nil },
+		},
+		{
+			name:  "top level",
+			paths: []PrunePath{{Fields: []int32{3}}},
+			edit:  func(pod *corev1.Pod) { pod.Status = corev1.PodStatus{} },
+		},
+		{
+			name: "several",
+			paths: []PrunePath{
+				{Fields: []int32{1, 17}},
+				{Fields: []int32{1, 12}, MapKey: "big"},
+				{Fields: []int32{2, 10}},
+			},
+			edit: func(pod *corev1.Pod) {
+				pod.ManagedFields = nil
+				delete(pod.Annotations, "big")
+				pod.Spec.NodeName = ""
+			},
+		},
+		{name: "missing field", paths: []PrunePath{{Fields: []int32{1, 99}}}},
+		{name: "missing map key", paths: []PrunePath{{Fields: []int32{1, 12}, MapKey: "none"}}},
+		{name: "no paths"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dAtA := marshalPod(t, fixturePod())
+			want := fixturePod()
+			if tt.edit != nil {
+				tt.edit(want)
+			}
+			wantData := marshalPod(t, want)
+
+			n, err := PruneFields(dAtA, tt.paths)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.edit == nil && !bytes.Equal(dAtA[:n], wantData) {
+				t.Errorf("message without matching fields changed")
+			}
+			// Zero values are still encoded by Marshal while PruneFields drops the fields entirely,
+			// so the result is compared after a round trip.
+			var pod corev1.Pod
+			if err := pod.Unmarshal(dAtA[:n]); err != nil {
+				t.Fatal(err)
+			}
+			got := marshalPod(t, &pod)
+			if !bytes.Equal(got, wantData) {
+				t.Errorf("pruned message differs:\ngot  %x\nwant %x", got, wantData)
+			}
+		})
+	}
+}
+
+func TestPruneFieldsInvalid(t *testing.T) {
+	dAtA := marshalPod(t, fixturePod())
+	if _, err := PruneFields(dAtA[:len(dAtA)-1], []PrunePath{{Fields: []int32{3}}}); err == nil {
+		t.Fatal("expected an error for a truncated message")
+	}
+	// Length of the metadata field larger than the message.
+	if _, err := PruneFields([]byte{0x0a, 0x7f, 0x0a}, []PrunePath{{Fields: []int32{1, 17}}}); err == nil {
+		t.Fatal("expected an error for an invalid length")
+	}
+}
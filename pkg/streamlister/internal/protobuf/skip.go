@@ -0,0 +1,116 @@
+package protobuf
+
+import (
+	"fmt"
+	"io"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// skipField consumes the value of a field with the given wire type starting at iNdEx,
+// it returns the index right after the value. l is the length of dAtA, or negative if unknown.
+func skipField(dAtA *StreamBuffer, iNdEx int, l int, wireType int) (int, error) {
+	depth := 0
+	for {
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, runtime.ErrIntOverflowGenerated
+				}
+				if l >= 0 && iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b, err := dAtA.Get(iNdEx)
+				if err != nil {
+					return 0, unexpectedEOF(err)
+				}
+				iNdEx++
+				if b < 0x80 {
+					break
+				}
+			}
+		case 1, 2, 5:
+			var length int
+			switch wireType {
+			case 1:
+				length = 8
+			case 5:
+				length = 4
+			default:
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return 0, runtime.ErrIntOverflowGenerated
+					}
+					if l >= 0 && iNdEx >= l {
+						return 0, io.ErrUnexpectedEOF
+					}
+					b, err := dAtA.Get(iNdEx)
+					if err != nil {
+						return 0, unexpectedEOF(err)
+					}
+					iNdEx++
+					length |= int(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if length < 0 {
+					return 0, runtime.ErrInvalidLengthGenerated
+				}
+			}
+			postIndex := iNdEx + length
+			if postIndex < 0 {
+				return 0, runtime.ErrInvalidLengthGenerated
+			}
+			if l >= 0 && postIndex > l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			if err := dAtA.Skip(iNdEx, postIndex); err != nil {
+				return 0, unexpectedEOF(err)
+			}
+			iNdEx = postIndex
+		case 3:
+			depth++
+		case 4:
+			if depth == 0 {
+				return 0, runtime.ErrUnexpectedEndOfGroupGenerated
+			}
+			depth--
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+		if depth == 0 {
+			return iNdEx, nil
+		}
+
+		// Inside a group, read the tag of the next field.
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, runtime.ErrIntOverflowGenerated
+			}
+			if l >= 0 && iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b, err := dAtA.Get(iNdEx)
+			if err != nil {
+				return 0, unexpectedEOF(err)
+			}
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType = int(wire & 0x7)
+	}
+}
+
+// unexpectedEOF converts io.EOF, the field value is always expected once its tag is read.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
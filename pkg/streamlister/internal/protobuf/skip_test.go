@@ -0,0 +1,119 @@
+package protobuf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/types"
+)
+
+func TestSkipField(t *testing.T) {
+	// Every value is followed by a trailing byte which must not be consumed.
+	tests := []struct {
+		name     string
+		wireType int
+		value    []byte
+		wantErr  error
+	}{
+		{name: "varint", wireType: 0, value: []byte{0x96, 0x01}},
+		{name: "fixed64", wireType: 1, value: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{name: "bytes", wireType: 2, value: []byte{0x03, 'a', 'b', 'c'}},
+		{name: "fixed32", wireType: 5, value: []byte{1, 2, 3, 4}},
+		// Group 1 holding a varint, a fixed32, a fixed64 and group 2 with a string, then the end of group 1.
+		{name: "group", wireType: 3, value: []byte{
+			0x08, 0x01,
+			0x15, 1, 2, 3, 4,
+			0x19, 1, 2, 3, 4, 5, 6, 7, 8,
+			0x13, 0x1a, 0x01, 'x', 0x14,
+			0x0c,
+		}},
+		{name: "empty group", wireType: 3, value: []byte{0x0c}},
+		{name: "end group", wireType: 4, wantErr: runtime.ErrUnexpectedEndOfGroupGenerated},
+		{name: "illegal wire type", wireType: 6, wantErr: errors.New("proto: illegal wireType 6")},
+		{name: "truncated fixed64", wireType: 1, value: []byte{1, 2, 3}, wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated fixed32", wireType: 5, value: []byte{1, 2}, wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated bytes", wireType: 2, value: []byte{0x05, 'a'}, wantErr: io.ErrUnexpectedEOF},
+		{name: "unterminated group", wireType: 3, value: []byte{0x08, 0x01}, wantErr: io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		for _, knownLen := range []bool{true, false} {
+			name := tt.name
+			if !knownLen {
+				name += "/unknown length"
+			}
+			t.Run(name, func(t *testing.T) {
+				dAtA := tt.value
+				if tt.wantErr == nil {
+					dAtA = append(append([]byte(nil), tt.value...), 0xff)
+				}
+				l := len(dAtA)
+				if !knownLen {
+					l = -1
+				}
+				got, err := skipField(NewStreamBuffer(bytes.NewReader(dAtA), l), 0, l, tt.wireType)
+				if tt.wantErr != nil {
+					if err == nil || err.Error() != tt.wantErr.Error() {
+						t.Fatalf("error got %v, want %v", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != len(tt.value) {
+					t.Errorf("index got %d, want %d", got, len(tt.value))
+				}
+			})
+		}
+	}
+}
+
+func TestListStreamUnmarshalerSkipsUnknownFields(t *testing.T) {
+	pod, err := (&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "a"}}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Unknown fields 3 to 7 of every wire type precede the item.
+	dAtA := []byte{
+		0x18, 0x96, 0x01,
+		0x21, 1, 2, 3, 4, 5, 6, 7, 8,
+		0x2a, 0x01, 'x',
+		0x33, 0x08, 0x01, 0x34,
+		0x3d, 1, 2, 3, 4,
+	}
+	dAtA = appendField(dAtA, 2, pod)
+
+	type unknownField struct {
+		num      int32
+		wireType int
+	}
+	var unknown []unknownField
+	var names []string
+	err = ListStreamUnmarshaler{
+		OnUnknownField: func(fieldNum int32, wireType int) {
+			unknown = append(unknown, unknownField{fieldNum, wireType})
+		},
+	}.Unmarshal(NewStreamBuffer(bytes.NewReader(dAtA), len(dAtA)), types.ParamWithErrorFuncs{
+		ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+		OnObjectFunc: func(o runtime.Object) error {
+			names = append(names, o.(*corev1.Pod).Name)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []unknownField{{3, 0}, {4, 1}, {5, 2}, {6, 3}, {7, 5}}; !reflect.DeepEqual(unknown, want) {
+		t.Errorf("unknown fields got %v, want %v", unknown, want)
+	}
+	if !reflect.DeepEqual(names, []string{"a"}) {
+		t.Errorf("items got %v", names)
+	}
+}
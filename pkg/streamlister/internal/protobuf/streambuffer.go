@@ -1,16 +1,25 @@
 package protobuf
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/bits"
+	"sync"
 )
 
+const streamBufferSize = 32 * 1024
+
+// StreamBuffer reads a protobuf message forward only, bytes before the current index can not be read again.
 type StreamBuffer struct {
 	idx int
 	len int
 	r   io.Reader
+
+	// buf[rpos:wpos] holds bytes starting at idx which are read from r but not consumed yet.
+	buf  []byte
+	rpos int
+	wpos int
 }
 
 func NewStreamBuffer(r io.Reader, len int) *StreamBuffer {
@@ -24,19 +33,131 @@ func (s *StreamBuffer) Len() int {
 	return s.len
 }
 
+func (s *StreamBuffer) fill() error {
+	if s.buf == nil {
+		size := streamBufferSize
+		if s.len >= 0 && s.len < size {
+			size = s.len
+		}
+		if size == 0 {
+			return io.EOF
+		}
+		s.buf = make([]byte, size)
+	}
+	if s.rpos == s.wpos {
+		s.rpos, s.wpos = 0, 0
+	}
+	for {
+		n, err := s.r.Read(s.buf[s.wpos:])
+		s.wpos += n
+		if n > 0 {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// skip consumes n bytes.
+func (s *StreamBuffer) skip(n int) error {
+	for n > 0 {
+		if s.rpos == s.wpos {
+			if err := s.fill(); err != nil {
+				if err == io.EOF {
+					return io.ErrUnexpectedEOF
+				}
+				return err
+			}
+		}
+		m := s.wpos - s.rpos
+		if m > n {
+			m = n
+		}
+		s.rpos += m
+		s.idx += m
+		n -= m
+	}
+	return nil
+}
+
+// read implements io.Reader over the unconsumed bytes.
+func (s *StreamBuffer) read(p []byte) (int, error) {
+	if s.rpos == s.wpos {
+		if len(p) >= len(s.buf) {
+			// Large reads bypass the buffer.
+			n, err := s.r.Read(p)
+			s.idx += n
+			return n, err
+		}
+		if err := s.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.buf[s.rpos:s.wpos])
+	s.rpos += n
+	s.idx += n
+	return n, nil
+}
+
+// Reader returns an io.Reader which consumes the buffer from the current index.
+func (s *StreamBuffer) Reader() io.Reader {
+	return streamBufferReader{s: s}
+}
+
+// Peek returns at most n bytes from the current index without consuming them,
+// fewer bytes are returned only when the stream ends.
+func (s *StreamBuffer) Peek(n int) ([]byte, error) {
+	for s.wpos-s.rpos < n {
+		if s.rpos > 0 {
+			copy(s.buf, s.buf[s.rpos:s.wpos])
+			s.wpos -= s.rpos
+			s.rpos = 0
+		}
+		if s.buf != nil && s.wpos == len(s.buf) {
+			break
+		}
+		if err := s.fill(); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+	}
+	if s.wpos-s.rpos < n {
+		n = s.wpos - s.rpos
+	}
+	return s.buf[s.rpos : s.rpos+n], nil
+}
+
+type streamBufferReader struct {
+	s *StreamBuffer
+}
+
+func (r streamBufferReader) Read(p []byte) (int, error) {
+	return r.s.read(p)
+}
+
 func (s *StreamBuffer) Get(i int) (byte, error) {
 	if i < s.idx {
 		return 0, fmt.Errorf("invalid index %d < %d", i, s.idx)
 	}
-	needRead := i - s.idx + 1
-	buf := make([]byte, needRead)
-	if _, err := io.ReadFull(s.r, buf); err != nil {
+	if err := s.skip(i - s.idx); err != nil {
 		return 0, err
 	}
-	s.idx = i + 1
-	return buf[needRead-1], nil
+	if s.rpos == s.wpos {
+		if err := s.fill(); err != nil {
+			return 0, err
+		}
+	}
+	b := s.buf[s.rpos]
+	s.rpos++
+	s.idx++
+	return b, nil
 }
 
+// Slice returns the bytes in [start, end), the result can be handed back with ReleaseSlice
+// once nothing references it.
 func (s *StreamBuffer) Slice(start, end int) ([]byte, error) {
 	if start < s.idx {
 		return nil, fmt.Errorf("invalid index %d < %d", start, s.idx)
@@ -44,15 +165,23 @@ func (s *StreamBuffer) Slice(start, end int) ([]byte, error) {
 	if start == end {
 		return []byte{}, nil
 	}
-	newIdx := end
-	start -= s.idx
-	end -= s.idx
-	buf := make([]byte, end)
-	if _, err := io.ReadFull(s.r, buf); err != nil {
+	if err := s.skip(start - s.idx); err != nil {
+		return nil, err
+	}
+	buf := getSlice(end - start)
+	if _, err := io.ReadFull(streamBufferReader{s: s}, buf); err != nil {
+		ReleaseSlice(buf)
 		return nil, err
 	}
-	s.idx = newIdx
-	return buf[start:end], nil
+	return buf, nil
+}
+
+// Skip consumes the bytes in [start, end) without reading them into memory.
+func (s *StreamBuffer) Skip(start, end int) error {
+	if start < s.idx {
+		return fmt.Errorf("invalid index %d < %d", start, s.idx)
+	}
+	return s.skip(end - s.idx)
 }
 
 func (s *StreamBuffer) SubStream(start, end int) (*StreamBuffer, error) {
@@ -60,21 +189,65 @@ func (s *StreamBuffer) SubStream(start, end int) (*StreamBuffer, error) {
 		return nil, fmt.Errorf("invalid index %d < %d", start, s.idx)
 	}
 	if start == end {
-		return NewStreamBuffer(bytes.NewReader(nil), 0), nil
-	}
-	newIdx := end
-	start -= s.idx
-	end -= s.idx
-	s.idx = newIdx
-	if start > 0 {
-		if _, err := io.Copy(ioutil.Discard, io.LimitReader(s.r, int64(start))); err != nil {
-			return nil, err
-		}
+		return NewStreamBuffer(eofReader{}, 0), nil
+	}
+	if err := s.skip(start - s.idx); err != nil {
+		return nil, err
 	}
-	return NewStreamBuffer(io.LimitReader(s.r, int64(end-start)), end-start), nil
+	return NewStreamBuffer(io.LimitReader(streamBufferReader{s: s}, int64(end-start)), end-start), nil
 }
 
 func (s *StreamBuffer) Discard() error {
+	s.idx += s.wpos - s.rpos
+	s.rpos, s.wpos = 0, 0
 	_, err := io.Copy(ioutil.Discard, s.r)
 	return err
 }
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
+// Slices up to 16MiB are pooled by power of two capacity.
+const maxPooledSliceBits = 24
+
+var (
+	slicePools [maxPooledSliceBits + 1]sync.Pool
+	// boxPool recycles the *[]byte stored in slicePools, so that releasing a slice does not allocate.
+	boxPool sync.Pool
+)
+
+func getSlice(n int) []byte {
+	b := bits.Len(uint(n - 1))
+	if b > maxPooledSliceBits {
+		return make([]byte, n)
+	}
+	if box, ok := slicePools[b].Get().(*[]byte); ok {
+		buf := *box
+		*box = nil
+		boxPool.Put(box)
+		return buf[:n]
+	}
+	return make([]byte, n, 1<<b)
+}
+
+// ReleaseSlice puts a slice returned by StreamBuffer.Slice back to the pool.
+// Generated Unmarshal methods copy what they keep, so it is safe to release right after unmarshalling.
+func ReleaseSlice(buf []byte) {
+	c := cap(buf)
+	if c == 0 || c&(c-1) != 0 {
+		return
+	}
+	b := bits.Len(uint(c - 1))
+	if b > maxPooledSliceBits {
+		return
+	}
+	box, ok := boxPool.Get().(*[]byte)
+	if !ok {
+		box = new([]byte)
+	}
+	*box = buf[:0]
+	slicePools[b].Put(box)
+}
@@ -7,19 +7,24 @@ import (
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/types"
 )
 
 type UnknownStreamUnmarshaler struct {
-	OnTypeMeta        func(*metav1.TypeMeta)
+	OnTypeMeta        func(*metav1.TypeMeta) error
 	OnRaw             func(*StreamBuffer) error
-	OnContentEncoding func(string)
-	OnContentType     func(string)
+	OnContentEncoding func(string) error
+	OnContentType     func(string) error
+	OnUnknownField    func(fieldNum int32, wireType int)
+	// MaxResponseBytes fails with types.LimitExceededError before allocating a longer field, zero means no limit.
+	MaxResponseBytes int
 }
 
 func (u UnknownStreamUnmarshaler) Unmarshal(buffer *StreamBuffer) error {
 	onTypeMeta := u.OnTypeMeta
 	if onTypeMeta == nil {
-		onTypeMeta = func(*metav1.TypeMeta) {}
+		onTypeMeta = func(*metav1.TypeMeta) error { return nil }
 	}
 	onRaw := u.OnRaw
 	if onRaw == nil {
@@ -29,11 +34,11 @@ func (u UnknownStreamUnmarshaler) Unmarshal(buffer *StreamBuffer) error {
 	}
 	onContentEncoding := u.OnContentEncoding
 	if onContentEncoding == nil {
-		onContentEncoding = func(string) {}
+		onContentEncoding = func(string) error { return nil }
 	}
 	onContentType := u.OnContentType
 	if onContentType == nil {
-		onContentType = func(string) {}
+		onContentType = func(string) error { return nil }
 	}
 
 	iNdEx := 0
@@ -47,7 +52,11 @@ Loop:
 			b, err := buffer.Get(iNdEx)
 			if err != nil {
 				if errors.Is(err, io.EOF) {
-					break Loop
+					if shift == 0 {
+						break Loop
+					}
+					// A tag cut in the middle is a truncated response, not the end of it.
+					return io.ErrUnexpectedEOF
 				}
 				return err
 			}
@@ -77,7 +86,7 @@ Loop:
 				}
 				b, err := buffer.Get(iNdEx)
 				if err != nil {
-					return err
+					return unexpectedEOF(err)
 				}
 				iNdEx++
 				msglen |= int(b&0x7F) << shift
@@ -92,15 +101,24 @@ Loop:
 			if postIndex < 0 {
 				return runtime.ErrInvalidLengthGenerated
 			}
+			if u.MaxResponseBytes > 0 && postIndex-iNdEx > u.MaxResponseBytes {
+				return &types.LimitExceededError{Limit: types.LimitMaxResponseBytes, Max: int64(u.MaxResponseBytes), Actual: int64(postIndex - iNdEx)}
+			}
 			buf, err := buffer.Slice(iNdEx, postIndex)
 			if err != nil {
-				return err
+				return unexpectedEOF(err)
 			}
-			var typeMeta metav1.TypeMeta
-			if err := typeMeta.Unmarshal(buf); err != nil {
+			// runtime.TypeMeta numbers its fields differently from metav1.TypeMeta.
+			var unknownTypeMeta runtime.TypeMeta
+			err = unknownTypeMeta.Unmarshal(buf)
+			ReleaseSlice(buf)
+			if err != nil {
 				return err
 			}
-			onTypeMeta(&typeMeta)
+			typeMeta := metav1.TypeMeta{APIVersion: unknownTypeMeta.APIVersion, Kind: unknownTypeMeta.Kind}
+			if err := onTypeMeta(&typeMeta); err != nil {
+				return fmt.Errorf("OnTypeMeta: %w", err)
+			}
 			iNdEx = postIndex
 		case 2:
 			if wireType != 2 {
@@ -113,7 +131,7 @@ Loop:
 				}
 				b, err := buffer.Get(iNdEx)
 				if err != nil {
-					return err
+					return unexpectedEOF(err)
 				}
 				iNdEx++
 				byteLen |= int(b&0x7F) << shift
@@ -130,7 +148,7 @@ Loop:
 			}
 			stream, err := buffer.SubStream(iNdEx, postIndex)
 			if err != nil {
-				return err
+				return unexpectedEOF(err)
 			}
 			if err := onRaw(stream); err != nil {
 				return err
@@ -147,7 +165,7 @@ Loop:
 				}
 				b, err := buffer.Get(iNdEx)
 				if err != nil {
-					return err
+					return unexpectedEOF(err)
 				}
 				iNdEx++
 				stringLen |= uint64(b&0x7F) << shift
@@ -163,11 +181,18 @@ Loop:
 			if postIndex < 0 {
 				return runtime.ErrInvalidLengthGenerated
 			}
+			if u.MaxResponseBytes > 0 && postIndex-iNdEx > u.MaxResponseBytes {
+				return &types.LimitExceededError{Limit: types.LimitMaxResponseBytes, Max: int64(u.MaxResponseBytes), Actual: int64(postIndex - iNdEx)}
+			}
 			buf, err := buffer.Slice(iNdEx, postIndex)
 			if err != nil {
-				return err
+				return unexpectedEOF(err)
+			}
+			value := string(buf)
+			ReleaseSlice(buf)
+			if err := onContentEncoding(value); err != nil {
+				return fmt.Errorf("OnContentEncoding: %w", err)
 			}
-			onContentEncoding(string(buf))
 			iNdEx = postIndex
 		case 4:
 			if wireType != 2 {
@@ -180,7 +205,7 @@ Loop:
 				}
 				b, err := buffer.Get(iNdEx)
 				if err != nil {
-					return err
+					return unexpectedEOF(err)
 				}
 				iNdEx++
 				stringLen |= uint64(b&0x7F) << shift
@@ -196,14 +221,28 @@ Loop:
 			if postIndex < 0 {
 				return runtime.ErrInvalidLengthGenerated
 			}
+			if u.MaxResponseBytes > 0 && postIndex-iNdEx > u.MaxResponseBytes {
+				return &types.LimitExceededError{Limit: types.LimitMaxResponseBytes, Max: int64(u.MaxResponseBytes), Actual: int64(postIndex - iNdEx)}
+			}
 			buf, err := buffer.Slice(iNdEx, postIndex)
 			if err != nil {
-				return err
+				return unexpectedEOF(err)
+			}
+			value := string(buf)
+			ReleaseSlice(buf)
+			if err := onContentType(value); err != nil {
+				return fmt.Errorf("OnContentType: %w", err)
 			}
-			onContentType(string(buf))
 			iNdEx = postIndex
 		default:
-			break Loop
+			if u.OnUnknownField != nil {
+				u.OnUnknownField(fieldNum, wireType)
+			}
+			postIndex, err := skipField(buffer, iNdEx, -1, wireType)
+			if err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		}
 	}
 	return buffer.Discard()
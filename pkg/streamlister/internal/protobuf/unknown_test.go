@@ -0,0 +1,55 @@
+package protobuf
+
+import (
+	"bytes"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sprotobuf "k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+func TestUnknownStreamUnmarshalerTypeMeta(t *testing.T) {
+	list := &corev1.PodList{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"},
+		ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+		Items:    []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "a"}}},
+	}
+	var body bytes.Buffer
+	if err := k8sprotobuf.NewSerializer(scheme.Scheme, scheme.Scheme).Encode(list, &body); err != nil {
+		t.Fatal(err)
+	}
+	data := body.Bytes()
+	if !bytes.HasPrefix(data, []byte("k8s\x00")) {
+		t.Fatalf("serializer output has no k8s envelope prefix: %q", data[:4])
+	}
+	data = data[4:]
+
+	var typeMeta metav1.TypeMeta
+	var raw []byte
+	err := UnknownStreamUnmarshaler{
+		OnTypeMeta: func(meta *metav1.TypeMeta) error {
+			typeMeta = *meta
+			return nil
+		},
+		OnRaw: func(b *StreamBuffer) error {
+			var err error
+			raw, err = b.Slice(0, b.Len())
+			return err
+		},
+	}.Unmarshal(NewStreamBuffer(bytes.NewReader(data), len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typeMeta.APIVersion != "v1" || typeMeta.Kind != "PodList" {
+		t.Errorf("got apiVersion %q kind %q, want v1 PodList", typeMeta.APIVersion, typeMeta.Kind)
+	}
+	var decoded corev1.PodList
+	if err := decoded.Unmarshal(raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Items) != 1 || decoded.Items[0].Name != "a" {
+		t.Errorf("raw decoded to %+v", decoded.Items)
+	}
+}
@@ -0,0 +1,27 @@
+package types
+
+import (
+	"fmt"
+)
+
+// Limit names a limit of LimitExceededError.
+type Limit string
+
+const (
+	LimitMaxItemBytes     Limit = "MaxItemBytes"
+	LimitMaxResponseBytes Limit = "MaxResponseBytes"
+	LimitMaxItems         Limit = "MaxItems"
+)
+
+// LimitExceededError is returned as soon as a response is known to exceed a limit, before the offending
+// item is allocated.
+type LimitExceededError struct {
+	Limit Limit
+	Max   int64
+	// Actual is the size claimed by the stream, or a lower bound of it if the size is not known in advance.
+	Actual int64
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("limit %s=%d exceeded: %d", e.Limit, e.Max, e.Actual)
+}
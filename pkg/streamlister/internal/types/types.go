@@ -1,11 +1,18 @@
 package types
 
 import (
+	"errors"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// ErrStop can be returned by callbacks to stop streaming without reporting an error.
+var ErrStop = errors.New("stop streaming")
+
 type ParamInterface interface {
+	// ObjectFactory returns a new object for every item. Its Unmarshal must not retain the bytes it is passed,
+	// they are reused for later items once it returns, which holds for the generated Kubernetes API types.
 	ObjectFactory() runtime.Object
 	OnListMeta(*metav1.ListMeta)
 	OnTypeMeta(*metav1.TypeMeta)
@@ -40,3 +47,70 @@ func (p ParamFuncs) OnTypeMeta(meta *metav1.TypeMeta) {
 func (p ParamFuncs) OnObject(o runtime.Object) {
 	p.OnObjectFunc(o)
 }
+
+type ParamWithErrorInterface interface {
+	// ObjectFactory is the same as ParamInterface.ObjectFactory.
+	ObjectFactory() runtime.Object
+	OnListMeta(*metav1.ListMeta) error
+	OnTypeMeta(*metav1.TypeMeta) error
+	OnObject(runtime.Object) error
+}
+
+type ParamWithErrorFuncs struct {
+	ObjectFactoryFunc func() runtime.Object
+	OnListMetaFunc    func(*metav1.ListMeta) error
+	OnTypeMetaFunc    func(*metav1.TypeMeta) error
+	OnObjectFunc      func(runtime.Object) error
+}
+
+func (p ParamWithErrorFuncs) ObjectFactory() runtime.Object {
+	return p.ObjectFactoryFunc()
+}
+
+func (p ParamWithErrorFuncs) OnListMeta(meta *metav1.ListMeta) error {
+	onListMetaFunc := p.OnListMetaFunc
+	if onListMetaFunc != nil {
+		return onListMetaFunc(meta)
+	}
+	return nil
+}
+
+func (p ParamWithErrorFuncs) OnTypeMeta(meta *metav1.TypeMeta) error {
+	onTypeMetaFunc := p.OnTypeMetaFunc
+	if onTypeMetaFunc != nil {
+		return onTypeMetaFunc(meta)
+	}
+	return nil
+}
+
+func (p ParamWithErrorFuncs) OnObject(o runtime.Object) error {
+	return p.OnObjectFunc(o)
+}
+
+// WithError adapts a ParamInterface whose callbacks never fail.
+func WithError(p ParamInterface) ParamWithErrorInterface {
+	return paramWithError{p: p}
+}
+
+type paramWithError struct {
+	p ParamInterface
+}
+
+func (p paramWithError) ObjectFactory() runtime.Object {
+	return p.p.ObjectFactory()
+}
+
+func (p paramWithError) OnListMeta(meta *metav1.ListMeta) error {
+	p.p.OnListMeta(meta)
+	return nil
+}
+
+func (p paramWithError) OnTypeMeta(meta *metav1.TypeMeta) error {
+	p.p.OnTypeMeta(meta)
+	return nil
+}
+
+func (p paramWithError) OnObject(o runtime.Object) error {
+	p.p.OnObject(o)
+	return nil
+}
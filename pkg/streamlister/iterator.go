@@ -0,0 +1,118 @@
+package streamlister
+
+import (
+	"context"
+	"errors"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+)
+
+// WithBufferSize sets how many decoded objects an Iterator can hold before the stream is blocked.
+func WithBufferSize(size int) OptionFunc {
+	return func(options *streamListOptions) {
+		options.bufferSize = size
+	}
+}
+
+// Iterator turns StreamList into a pull model:
+//
+//	it := NewIterator(ctx, client, "pods", "", metav1.ListOptions{}, func() runtime.Object { return &corev1.Pod{} })
+//	defer it.Close()
+//	for it.Next() {
+//		pod := it.Object().(*corev1.Pod)
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type Iterator struct {
+	objects chan runtime.Object
+	cancel  context.CancelFunc
+	done    chan struct{}
+	closed  bool
+
+	object   runtime.Object
+	typeMeta metav1.TypeMeta
+	listMeta metav1.ListMeta
+	err      error
+}
+
+func NewIterator(ctx context.Context, client rest.Interface, resource string, namespace string, listOptions metav1.ListOptions, objectFactory func() runtime.Object, opts ...OptionFunc) *Iterator {
+	slo := createDefaultOptions()
+	for _, opt := range opts {
+		opt(slo)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	it := &Iterator{
+		objects: make(chan runtime.Object, slo.bufferSize),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(it.done)
+		defer close(it.objects)
+		it.err = StreamListWithError(ctx, client, resource, namespace, listOptions, ParamWithErrorFuncs{
+			ObjectFactoryFunc: objectFactory,
+			OnListMetaFunc: func(meta *metav1.ListMeta) error {
+				it.listMeta = *meta
+				return nil
+			},
+			OnTypeMetaFunc: func(meta *metav1.TypeMeta) error {
+				it.typeMeta = *meta
+				return nil
+			},
+			OnObjectFunc: func(o runtime.Object) error {
+				select {
+				case it.objects <- o:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			},
+		}, opts...)
+	}()
+	return it
+}
+
+// Next blocks until the next object is decoded, it returns false when the stream is finished or failed.
+func (it *Iterator) Next() bool {
+	o, ok := <-it.objects
+	if !ok {
+		<-it.done
+		it.object = nil
+		return false
+	}
+	it.object = o
+	return true
+}
+
+func (it *Iterator) Object() runtime.Object {
+	return it.object
+}
+
+// TypeMeta is only valid after Next returns false.
+func (it *Iterator) TypeMeta() *metav1.TypeMeta {
+	return &it.typeMeta
+}
+
+// ListMeta is only valid after Next returns false.
+func (it *Iterator) ListMeta() *metav1.ListMeta {
+	return &it.listMeta
+}
+
+func (it *Iterator) Err() error {
+	if it.closed && errors.Is(it.err, context.Canceled) {
+		return nil
+	}
+	return it.err
+}
+
+// Close stops the stream if it is still running, it is safe to call Close multiple times.
+func (it *Iterator) Close() {
+	it.closed = true
+	it.cancel()
+	for range it.objects {
+	}
+	<-it.done
+}
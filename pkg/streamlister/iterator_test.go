@@ -0,0 +1,160 @@
+package streamlister
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest/fake"
+)
+
+// endlessPodList is a JSON PodList body whose items never end.
+type endlessPodList struct {
+	started bool
+	pending []byte
+	closed  int32
+}
+
+func (b *endlessPodList) Read(p []byte) (int, error) {
+	if atomic.LoadInt32(&b.closed) != 0 {
+		return 0, io.ErrClosedPipe
+	}
+	if len(b.pending) == 0 {
+		if !b.started {
+			b.started = true
+			b.pending = []byte(`{"kind":"PodList","apiVersion":"v1","metadata":{},"items":[{"metadata":{"name":"pod"}}`)
+		} else {
+			b.pending = []byte(`,{"metadata":{"name":"pod"}}`)
+		}
+	}
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+	return n, nil
+}
+
+func (b *endlessPodList) Close() error {
+	atomic.StoreInt32(&b.closed, 1)
+	return nil
+}
+
+func bodyClient(body io.ReadCloser) *fake.RESTClient {
+	return &fake.RESTClient{
+		GroupVersion:         schema.GroupVersion{Version: "v1"},
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		Client: fake.CreateHTTPClient(func(*http.Request) (*http.Response, error) {
+			header := http.Header{}
+			header.Set("Content-Type", runtime.ContentTypeJSON)
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: body}, nil
+		}),
+	}
+}
+
+func newPodIterator(client *fake.RESTClient, opts ...OptionFunc) *Iterator {
+	return NewIterator(context.Background(), client, "pods", "", metav1.ListOptions{}, func() runtime.Object { return &corev1.Pod{} }, opts...)
+}
+
+func TestIterator(t *testing.T) {
+	jsonBody, _ := podListBodies(t, 100)
+	it := newPodIterator(fakeClient(runtime.ContentTypeJSON, jsonBody))
+	defer it.Close()
+	var names []string
+	for it.Next() {
+		names = append(names, it.Object().(*corev1.Pod).Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 100 || names[0] != "pod-0" || names[99] != "pod-99" {
+		t.Errorf("got %d items: %v", len(names), names)
+	}
+	if it.ListMeta().ResourceVersion != "1" || it.TypeMeta().Kind != "PodList" {
+		t.Errorf("got ListMeta %+v and TypeMeta %+v", it.ListMeta(), it.TypeMeta())
+	}
+	if it.Object() != nil {
+		t.Errorf("Object got %v after Next returned false", it.Object())
+	}
+}
+
+func TestIteratorEarlyClose(t *testing.T) {
+	body := &endlessPodList{}
+	it := newPodIterator(bodyClient(body))
+	for i := 0; i < 10; i++ {
+		if !it.Next() {
+			t.Fatalf("Next returned false after %d items: %v", i, it.Err())
+		}
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		it.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close did not stop the stream")
+	}
+	select {
+	case <-it.done:
+	default:
+		t.Fatal("the stream goroutine is still running after Close")
+	}
+	if atomic.LoadInt32(&body.closed) == 0 {
+		t.Error("the response body was not closed")
+	}
+	if err := it.Err(); err != nil {
+		t.Errorf("Err got %v after Close", err)
+	}
+	if it.Next() {
+		t.Error("Next returned true after Close")
+	}
+	it.Close()
+}
+
+func TestIteratorErr(t *testing.T) {
+	jsonBody, _ := podListBodies(t, 10)
+	// Cut the body inside the items, the first ones are still delivered.
+	it := newPodIterator(fakeClient(runtime.ContentTypeJSON, jsonBody[:len(jsonBody)/2]))
+	defer it.Close()
+	n := 0
+	for it.Next() {
+		n++
+	}
+	if it.Err() == nil {
+		t.Fatal("Err got nil for a truncated list")
+	}
+	if n == 0 || n >= 10 {
+		t.Errorf("got %d items before the error", n)
+	}
+}
+
+func TestIteratorBufferSize(t *testing.T) {
+	it := newPodIterator(bodyClient(&endlessPodList{}), WithBufferSize(5))
+	defer it.Close()
+	if cap(it.objects) != 5 {
+		t.Fatalf("buffer size got %d, want 5", cap(it.objects))
+	}
+	// Without Next the stream decodes ahead until the buffer is full and then blocks.
+	deadline := time.Now().Add(10 * time.Second)
+	for len(it.objects) < 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("buffered %d objects, want 5", len(it.objects))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(it.objects) != 5 {
+		t.Errorf("buffered %d objects, want 5", len(it.objects))
+	}
+	if !it.Next() || it.Object().(*corev1.Pod).Name != "pod" {
+		t.Fatalf("Next got %v, %v", it.Object(), it.Err())
+	}
+}
@@ -0,0 +1,76 @@
+package streamlister
+
+import (
+	"io"
+
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/types"
+)
+
+type Limit = types.Limit
+
+const (
+	LimitMaxItemBytes     = types.LimitMaxItemBytes
+	LimitMaxResponseBytes = types.LimitMaxResponseBytes
+	LimitMaxItems         = types.LimitMaxItems
+)
+
+type LimitExceededError = types.LimitExceededError
+
+// Limits protect against huge or corrupted responses, they apply to every response on its own.
+// Zero means no limit.
+type Limits struct {
+	// MaxItemBytes is the encoded size of a single item.
+	MaxItemBytes int64
+	// MaxResponseBytes is the size of a response after decompression.
+	MaxResponseBytes int64
+	MaxItems         int
+}
+
+// WithLimits fails with LimitExceededError as soon as a response is known to exceed limits,
+// before the offending item is read into memory.
+func WithLimits(limits Limits) OptionFunc {
+	return func(options *streamListOptions) {
+		options.limits = limits
+	}
+}
+
+// limitReader fails with LimitExceededError instead of reading more than max bytes.
+type limitReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n >= l.max {
+		// Only fail if there is more to read.
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			return 0, &LimitExceededError{Limit: LimitMaxResponseBytes, Max: l.max, Actual: l.n + int64(n)}
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.max-l.n {
+		p = p[:l.max-l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	return n, err
+}
+
+// limitResponse applies MaxResponseBytes to the decompressed body.
+func (o *streamListOptions) limitResponse(r io.Reader) io.Reader {
+	if o.limits.MaxResponseBytes <= 0 {
+		return r
+	}
+	return &limitReader{r: r, max: o.limits.MaxResponseBytes}
+}
+
+// intLimit converts a byte limit for the protobuf decoders, which index with int.
+func intLimit(limit int64) int {
+	if limit <= 0 || int64(int(limit)) != limit {
+		return 0
+	}
+	return int(limit)
+}
@@ -0,0 +1,24 @@
+package streamlister
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+const partialObjectMetadataListParams = "as=PartialObjectMetadataList;g=meta.k8s.io;v=v1"
+
+// WithPartialObjectMetadata asks the apiserver for a PartialObjectMetadataList,
+// ObjectFactory must return *metav1.PartialObjectMetadata.
+func WithPartialObjectMetadata() OptionFunc {
+	return func(options *streamListOptions) {
+		options.partialObjectMetadata = true
+	}
+}
+
+// StreamListMetadata streams only the metadata of the listed objects.
+func StreamListMetadata(ctx context.Context, client rest.Interface, resource string, namespace string, listOptions metav1.ListOptions, param TypedParamFuncs[metav1.PartialObjectMetadata], opts ...OptionFunc) error {
+	opts = append([]OptionFunc{WithPartialObjectMetadata()}, opts...)
+	return StreamListTyped[metav1.PartialObjectMetadata](ctx, client, resource, namespace, listOptions, param, opts...)
+}
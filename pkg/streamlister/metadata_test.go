@@ -0,0 +1,88 @@
+package streamlister
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestStreamListMetadata(t *testing.T) {
+	list := &metav1.PartialObjectMetadataList{
+		ListMeta: metav1.ListMeta{ResourceVersion: "5"},
+		Items: []metav1.PartialObjectMetadata{
+			{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meta.k8s.io/v1", Kind: "PartialObjectMetadata"},
+				ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default", Labels: map[string]string{"app": "web"}},
+			},
+			{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "meta.k8s.io/v1", Kind: "PartialObjectMetadata"},
+				ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default", ResourceVersion: "4"},
+			},
+		},
+	}
+	raw, err := list.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := runtime.Unknown{TypeMeta: runtime.TypeMeta{APIVersion: "meta.k8s.io/v1", Kind: "PartialObjectMetadataList"}, Raw: raw}
+	protobufBody, err := unknown.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bodies := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{
+			name:        "json",
+			contentType: runtime.ContentTypeJSON,
+			body: `{"kind":"PartialObjectMetadataList","apiVersion":"meta.k8s.io/v1","metadata":{"resourceVersion":"5"},"items":[` +
+				`{"kind":"PartialObjectMetadata","apiVersion":"meta.k8s.io/v1","metadata":{"name":"a","namespace":"default","labels":{"app":"web"}}},` +
+				`{"kind":"PartialObjectMetadata","apiVersion":"meta.k8s.io/v1","metadata":{"name":"b","namespace":"default","resourceVersion":"4"}}]}`,
+		},
+		{name: "protobuf", contentType: runtime.ContentTypeProtobuf, body: "k8s\x00" + string(protobufBody)},
+	}
+	for _, tt := range bodies {
+		t.Run(tt.name, func(t *testing.T) {
+			var typeMeta metav1.TypeMeta
+			var listMeta metav1.ListMeta
+			var items []*metav1.PartialObjectMetadata
+			err := StreamListMetadata(context.Background(), fakeClient(tt.contentType, []byte(tt.body)), "pods", "", metav1.ListOptions{},
+				TypedParamFuncs[metav1.PartialObjectMetadata]{
+					OnTypeMetaFunc: func(meta *metav1.TypeMeta) error {
+						typeMeta = *meta
+						return nil
+					},
+					OnListMetaFunc: func(meta *metav1.ListMeta) error {
+						listMeta = *meta
+						return nil
+					},
+					OnObjectFunc: func(item *metav1.PartialObjectMetadata) error {
+						items = append(items, item)
+						return nil
+					},
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if typeMeta.APIVersion != "meta.k8s.io/v1" || typeMeta.Kind != "PartialObjectMetadataList" {
+				t.Errorf("OnTypeMeta got %+v", typeMeta)
+			}
+			if listMeta.ResourceVersion != "5" {
+				t.Errorf("OnListMeta got %+v", listMeta)
+			}
+			if len(items) != 2 {
+				t.Fatalf("got %d items", len(items))
+			}
+			if items[0].Name != "a" || items[0].Labels["app"] != "web" {
+				t.Errorf("item 0 got %+v", items[0])
+			}
+			if items[1].Name != "b" || items[1].ResourceVersion != "4" {
+				t.Errorf("item 1 got %+v", items[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package streamlister
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Outcome is how a single list request ended.
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	// OutcomeStopped means a callback returned ErrStop.
+	OutcomeStopped  Outcome = "stopped"
+	OutcomeCanceled Outcome = "canceled"
+	OutcomeError    Outcome = "error"
+)
+
+// RequestInfo identifies the list request being observed.
+type RequestInfo struct {
+	Resource  string
+	Namespace string
+}
+
+// RequestResult summarizes a finished list request.
+type RequestResult struct {
+	// Encoding is empty if the response was not decoded at all.
+	Encoding Encoding
+	Outcome  Outcome
+	// TransferredBytes is read from the connection, DecodedBytes is the size after decompression.
+	TransferredBytes int64
+	DecodedBytes     int64
+	Items            int
+	Duration         time.Duration
+}
+
+// MetricsRecorder observes every list request sent by StreamList, paging and resuming send more than one request.
+// A single StreamList call makes one call at a time, but StreamListFanOut and concurrent StreamList calls sharing
+// a recorder call its methods concurrently, so implementations must be safe for concurrent use.
+type MetricsRecorder interface {
+	// ObserveTimeToFirstByte is called when the response header is received or the request failed.
+	ObserveTimeToFirstByte(info RequestInfo, d time.Duration)
+	// ObserveItemDecode is called with the time spent decoding each item.
+	ObserveItemDecode(info RequestInfo, encoding Encoding, d time.Duration)
+	// ObserveRequest is called once the request finishes.
+	ObserveRequest(info RequestInfo, result RequestResult)
+}
+
+func WithMetricsRecorder(recorder MetricsRecorder) OptionFunc {
+	return func(options *streamListOptions) {
+		options.metricsRecorder = recorder
+	}
+}
+
+// requestObserver feeds a MetricsRecorder for a single request, it is a no-op if the recorder is nil.
+type requestObserver struct {
+	recorder MetricsRecorder
+	info     RequestInfo
+	start    time.Time
+}
+
+func newRequestObserver(recorder MetricsRecorder, resource, namespace string) *requestObserver {
+	return &requestObserver{
+		recorder: recorder,
+		info:     RequestInfo{Resource: resource, Namespace: namespace},
+		start:    time.Now(),
+	}
+}
+
+func (o *requestObserver) responded() {
+	if o.recorder != nil {
+		o.recorder.ObserveTimeToFirstByte(o.info, time.Since(o.start))
+	}
+}
+
+// itemDecodeHook returns nil if there is no recorder, so that decoders do not measure at all.
+func (o *requestObserver) itemDecodeHook(encoding Encoding) func(d time.Duration) {
+	if o.recorder == nil {
+		return nil
+	}
+	return func(d time.Duration) {
+		o.recorder.ObserveItemDecode(o.info, encoding, d)
+	}
+}
+
+func (o *requestObserver) finished(ctx context.Context, result RequestResult, err error) {
+	if o.recorder == nil {
+		return
+	}
+	result.Duration = time.Since(o.start)
+	result.Outcome = outcomeOf(ctx, err)
+	o.recorder.ObserveRequest(o.info, result)
+}
+
+func outcomeOf(ctx context.Context, err error) Outcome {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, ErrStop):
+		return OutcomeStopped
+	case ctx.Err() != nil || errors.Is(err, context.Canceled):
+		return OutcomeCanceled
+	default:
+		return OutcomeError
+	}
+}
@@ -0,0 +1,149 @@
+package streamlister
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+// fakeRecorder keeps every observation.
+type fakeRecorder struct {
+	mu             sync.Mutex
+	firstBytes     []RequestInfo
+	decodes        map[Encoding]int
+	decodeInfos    map[RequestInfo]int
+	negativeDecode bool
+	requests       []RequestResult
+	requestInfos   []RequestInfo
+}
+
+func (r *fakeRecorder) ObserveTimeToFirstByte(info RequestInfo, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.firstBytes = append(r.firstBytes, info)
+}
+
+func (r *fakeRecorder) ObserveItemDecode(info RequestInfo, encoding Encoding, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.decodes == nil {
+		r.decodes = make(map[Encoding]int)
+		r.decodeInfos = make(map[RequestInfo]int)
+	}
+	r.decodes[encoding]++
+	r.decodeInfos[info]++
+	r.negativeDecode = r.negativeDecode || d < 0
+}
+
+func (r *fakeRecorder) ObserveRequest(info RequestInfo, result RequestResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requestInfos = append(r.requestInfos, info)
+	r.requests = append(r.requests, result)
+}
+
+func recordMetrics(t *testing.T, handler http.Handler, onObject func(runtime.Object) error, opts ...OptionFunc) (*fakeRecorder, error) {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	client, err := NewRESTClient(&rest.Config{Host: srv.URL}, schema.GroupVersion{Version: "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &fakeRecorder{}
+	err = StreamListWithError(context.Background(), client, "pods", "default", metav1.ListOptions{}, ParamWithErrorFuncs{
+		ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+		OnObjectFunc:      onObject,
+	}, append(opts, WithMetricsRecorder(recorder))...)
+	return recorder, err
+}
+
+func TestMetricsRecorder(t *testing.T) {
+	info := RequestInfo{Resource: "pods", Namespace: "default"}
+	ignore := func(runtime.Object) error { return nil }
+
+	t.Run("json pages", func(t *testing.T) {
+		r, err := recordMetrics(t, &pagingServer{pods: podNames(50), pageSize: 20}, ignore, WithPaging(20))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.firstBytes) != 3 || len(r.requests) != 3 {
+			t.Fatalf("got %d ObserveTimeToFirstByte and %d ObserveRequest calls, want one per page", len(r.firstBytes), len(r.requests))
+		}
+		if r.decodes[EncodingJSON] != 50 || len(r.decodes) != 1 || r.decodeInfos[info] != 50 || r.negativeDecode {
+			t.Errorf("ObserveItemDecode got %v for %v", r.decodes, r.decodeInfos)
+		}
+		for i, want := range []int{20, 20, 10} {
+			if r.firstBytes[i] != info || r.requestInfos[i] != info {
+				t.Errorf("request %d info got %+v and %+v", i, r.firstBytes[i], r.requestInfos[i])
+			}
+			result := r.requests[i]
+			if result.Encoding != EncodingJSON || result.Outcome != OutcomeSuccess || result.Items != want {
+				t.Errorf("request %d got %+v", i, result)
+			}
+			if result.TransferredBytes <= 0 || result.DecodedBytes != result.TransferredBytes || result.Duration <= 0 {
+				t.Errorf("request %d got %d transferred and %d decoded bytes in %s", i, result.TransferredBytes, result.DecodedBytes, result.Duration)
+			}
+		}
+	})
+
+	t.Run("gzip protobuf", func(t *testing.T) {
+		r, err := recordMetrics(t, protobufServer(t, 50, ContentEncodingGzip), ignore, WithContentEncodings(ContentEncodingGzip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.decodes[EncodingProtobuf] != 50 || len(r.decodes) != 1 {
+			t.Errorf("ObserveItemDecode got %v", r.decodes)
+		}
+		if len(r.requests) != 1 {
+			t.Fatalf("got %d ObserveRequest calls", len(r.requests))
+		}
+		result := r.requests[0]
+		if result.Encoding != EncodingProtobuf || result.Outcome != OutcomeSuccess || result.Items != 50 {
+			t.Errorf("got %+v", result)
+		}
+		if result.TransferredBytes <= 0 || result.DecodedBytes <= result.TransferredBytes {
+			t.Errorf("got %d transferred bytes decompressed to %d", result.TransferredBytes, result.DecodedBytes)
+		}
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		n := 0
+		r, err := recordMetrics(t, protobufServer(t, 50, ""), func(runtime.Object) error {
+			n++
+			if n == 10 {
+				return ErrStop
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.requests) != 1 || r.requests[0].Outcome != OutcomeStopped || r.requests[0].Items != 10 {
+			t.Errorf("ObserveRequest got %+v", r.requests)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		r, err := recordMetrics(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}), ignore)
+		if err == nil {
+			t.Fatal("got no error")
+		}
+		if len(r.firstBytes) != 1 || len(r.decodes) != 0 {
+			t.Errorf("got %d ObserveTimeToFirstByte calls and ObserveItemDecode %v", len(r.firstBytes), r.decodes)
+		}
+		if len(r.requests) != 1 || r.requests[0].Outcome != OutcomeError || r.requests[0].Encoding != "" || r.requests[0].Items != 0 {
+			t.Errorf("ObserveRequest got %+v", r.requests)
+		}
+	})
+}
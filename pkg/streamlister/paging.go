@@ -0,0 +1,96 @@
+package streamlister
+
+import (
+	"context"
+	"errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// ExpiredContinuePolicy decides what to do when the apiserver rejects a continue token with 410 Gone.
+type ExpiredContinuePolicy int
+
+const (
+	// ExpiredContinueFail returns the 410 error to the caller.
+	ExpiredContinueFail ExpiredContinuePolicy = iota
+	// ExpiredContinueInconsistent keeps paging with the inconsistent continue token returned along with the 410 error,
+	// the remaining items are then served from a newer resource version.
+	ExpiredContinueInconsistent
+)
+
+// WithPaging makes StreamList follow ListMeta.Continue until the whole list is delivered.
+// If pageSize is positive it overrides ListOptions.Limit.
+func WithPaging(pageSize int64) OptionFunc {
+	return func(options *streamListOptions) {
+		options.paging = true
+		options.pageSize = pageSize
+	}
+}
+
+func WithExpiredContinuePolicy(policy ExpiredContinuePolicy) OptionFunc {
+	return func(options *streamListOptions) {
+		options.expiredContinuePolicy = policy
+	}
+}
+
+type pagingParam struct {
+	ParamWithErrorInterface
+	typeMetaSent bool
+	listMeta     metav1.ListMeta
+}
+
+func (p *pagingParam) OnListMeta(meta *metav1.ListMeta) error {
+	p.listMeta = *meta
+	return nil
+}
+
+func (p *pagingParam) OnTypeMeta(meta *metav1.TypeMeta) error {
+	if p.typeMetaSent {
+		return nil
+	}
+	p.typeMetaSent = true
+	return p.ParamWithErrorInterface.OnTypeMeta(meta)
+}
+
+func streamListPages(ctx context.Context, client rest.Interface, resource string, namespace string, listOptions metav1.ListOptions, param ParamWithErrorInterface, slo *streamListOptions) error {
+	if slo.pageSize > 0 {
+		listOptions.Limit = slo.pageSize
+	}
+
+	pp := &pagingParam{ParamWithErrorInterface: param}
+	for {
+		pp.listMeta = metav1.ListMeta{}
+		if err := streamListResumable(ctx, client, resource, namespace, listOptions, pp, slo); err != nil {
+			continueToken, ok := inconsistentContinue(err)
+			if !ok || listOptions.Continue == "" || slo.expiredContinuePolicy != ExpiredContinueInconsistent {
+				return err
+			}
+			listOptions.Continue = continueToken
+			continue
+		}
+		if pp.listMeta.Continue == "" {
+			break
+		}
+		listOptions.Continue = pp.listMeta.Continue
+		// resourceVersion is not allowed together with continue, the token carries it.
+		listOptions.ResourceVersion = ""
+		listOptions.ResourceVersionMatch = ""
+	}
+
+	listMeta := pp.listMeta
+	listMeta.RemainingItemCount = nil
+	return param.OnListMeta(&listMeta)
+}
+
+func inconsistentContinue(err error) (string, bool) {
+	if !apierrors.IsResourceExpired(err) {
+		return "", false
+	}
+	var statusErr *apierrors.StatusError
+	if !errors.As(err, &statusErr) || statusErr.ErrStatus.ListMeta.Continue == "" {
+		return "", false
+	}
+	return statusErr.ErrStatus.ListMeta.Continue, true
+}
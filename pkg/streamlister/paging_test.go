@@ -0,0 +1,155 @@
+package streamlister
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+const inconsistentPrefix = "inconsistent-"
+
+// pagingServer serves pods as JSON pages, the continue token is the index of the next item.
+type pagingServer struct {
+	pods     []string
+	pageSize int
+	// expireAt lists the requests rejected with 410 Gone and an inconsistent continue token.
+	expireAt map[int]bool
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func (s *pagingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	s.mu.Lock()
+	n := len(s.requests)
+	s.requests = append(s.requests, query.Get("continue"))
+	s.mu.Unlock()
+
+	token := query.Get("continue")
+	resourceVersion := "42"
+	if strings.HasPrefix(token, inconsistentPrefix) {
+		token = strings.TrimPrefix(token, inconsistentPrefix)
+		resourceVersion = "43"
+	}
+	start, _ := strconv.Atoi(token)
+	w.Header().Set("Content-Type", runtime.ContentTypeJSON)
+	if s.expireAt[n] {
+		w.WriteHeader(http.StatusGone)
+		_ = json.NewEncoder(w).Encode(&metav1.Status{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
+			ListMeta: metav1.ListMeta{Continue: inconsistentPrefix + token},
+			Status:   metav1.StatusFailure,
+			Reason:   metav1.StatusReasonExpired,
+			Code:     http.StatusGone,
+		})
+		return
+	}
+
+	end := start + s.pageSize
+	list := corev1.PodList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"}, ListMeta: metav1.ListMeta{ResourceVersion: resourceVersion}}
+	if end < len(s.pods) {
+		remaining := int64(len(s.pods) - end)
+		list.Continue = strconv.Itoa(end)
+		if resourceVersion != "42" {
+			list.Continue = inconsistentPrefix + list.Continue
+		}
+		list.RemainingItemCount = &remaining
+	} else {
+		end = len(s.pods)
+	}
+	for _, name := range s.pods[start:end] {
+		list.Items = append(list.Items, corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	_ = json.NewEncoder(w).Encode(&list)
+}
+
+func listPages(t *testing.T, s *pagingServer, opts ...OptionFunc) ([]string, []metav1.ListMeta, error) {
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	client, err := NewRESTClient(&rest.Config{Host: srv.URL}, schema.GroupVersion{Version: "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var listMetas []metav1.ListMeta
+	err = StreamListWithError(context.Background(), client, "pods", "", metav1.ListOptions{}, ParamWithErrorFuncs{
+		ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+		OnListMetaFunc: func(meta *metav1.ListMeta) error {
+			listMetas = append(listMetas, *meta)
+			return nil
+		},
+		OnObjectFunc: func(o runtime.Object) error {
+			names = append(names, o.(*corev1.Pod).Name)
+			return nil
+		},
+	}, opts...)
+	return names, listMetas, err
+}
+
+func TestStreamListPaging(t *testing.T) {
+	s := &pagingServer{pods: podNames(50), pageSize: 20}
+	names, listMetas, err := listPages(t, s, WithPaging(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkNames(t, names, s.pods)
+	if want := []string{"", "20", "40"}; strings.Join(s.requests, ",") != strings.Join(want, ",") {
+		t.Errorf("continue tokens got %q, want %q", s.requests, want)
+	}
+	if len(listMetas) != 1 {
+		t.Fatalf("OnListMeta called %d times, want once after the last page", len(listMetas))
+	}
+	if meta := listMetas[0]; meta.ResourceVersion != "42" || meta.Continue != "" || meta.RemainingItemCount != nil {
+		t.Errorf("OnListMeta got %+v", meta)
+	}
+}
+
+func TestStreamListPagingExpiredContinue(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy ExpiredContinuePolicy
+	}{
+		{name: "fail", policy: ExpiredContinueFail},
+		{name: "inconsistent", policy: ExpiredContinueInconsistent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &pagingServer{pods: podNames(50), pageSize: 20, expireAt: map[int]bool{1: true}}
+			names, listMetas, err := listPages(t, s, WithPaging(20), WithExpiredContinuePolicy(tt.policy))
+			switch tt.policy {
+			case ExpiredContinueFail:
+				if !apierrors.IsResourceExpired(err) {
+					t.Fatalf("got %v, want 410 Gone", err)
+				}
+				checkNames(t, names, s.pods[:20])
+				if len(s.requests) != 2 || len(listMetas) != 0 {
+					t.Errorf("got %d requests and %d OnListMeta calls after the 410", len(s.requests), len(listMetas))
+				}
+			case ExpiredContinueInconsistent:
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkNames(t, names, s.pods)
+				if want := []string{"", "20", "inconsistent-20", "inconsistent-40"}; strings.Join(s.requests, ",") != strings.Join(want, ",") {
+					t.Errorf("continue tokens got %q, want %q", s.requests, want)
+				}
+				if len(listMetas) != 1 || listMetas[0].ResourceVersion != "43" || listMetas[0].RemainingItemCount != nil {
+					t.Errorf("OnListMeta got %+v", listMetas)
+				}
+			}
+		})
+	}
+}
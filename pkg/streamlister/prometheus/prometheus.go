@@ -0,0 +1,154 @@
+// Package prometheus exports streamlister metrics to Prometheus.
+package prometheus
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ayanamist/k8s-utils/pkg/streamlister"
+)
+
+const subsystem = "streamlister"
+
+// Recorder implements streamlister.MetricsRecorder, it must be registered to a prometheus.Registerer
+// before metrics can be scraped.
+type Recorder struct {
+	namespaceLabel bool
+
+	timeToFirstByte  *prometheus.HistogramVec
+	itemDecode       *prometheus.HistogramVec
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	transferredBytes *prometheus.CounterVec
+	decodedBytes     *prometheus.CounterVec
+	items            *prometheus.CounterVec
+}
+
+var (
+	_ streamlister.MetricsRecorder = &Recorder{}
+	_ prometheus.Collector         = &Recorder{}
+)
+
+type Option func(r *Recorder)
+
+// WithNamespaceLabel adds the namespace of the request as a label. Only use it if the listed namespaces
+// are a small fixed set, every namespace creates its own series.
+func WithNamespaceLabel() Option {
+	return func(r *Recorder) {
+		r.namespaceLabel = true
+	}
+}
+
+// NewRecorder creates metrics prefixed with namespace, which may be empty.
+// Metrics are labeled by resource, but not by the namespace of the request unless WithNamespaceLabel is used.
+func NewRecorder(namespace string, opts ...Option) *Recorder {
+	r := &Recorder{}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.timeToFirstByte = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "time_to_first_byte_seconds",
+		Help:      "Time from sending a list request until the response header is received.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, r.labelNames())
+	r.itemDecode = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "item_decode_seconds",
+		Help:      "Time spent decoding a single list item.",
+		Buckets:   prometheus.ExponentialBuckets(0.000001, 4, 12),
+	}, r.labelNames("encoding"))
+	r.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "requests_total",
+		Help:      "Number of finished list requests.",
+	}, r.labelNames("encoding", "outcome"))
+	r.requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "request_duration_seconds",
+		Help:      "Time from sending a list request until the response is fully consumed.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+	}, r.labelNames("encoding", "outcome"))
+	r.transferredBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "transferred_bytes_total",
+		Help:      "Bytes of list responses read from the connection.",
+	}, r.labelNames("encoding"))
+	r.decodedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "decoded_bytes_total",
+		Help:      "Bytes of list responses after decompression.",
+	}, r.labelNames("encoding"))
+	r.items = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "items_total",
+		Help:      "Number of decoded list items.",
+	}, r.labelNames("encoding"))
+	return r
+}
+
+func (r *Recorder) labelNames(names ...string) []string {
+	labels := []string{"resource"}
+	if r.namespaceLabel {
+		labels = append(labels, "namespace")
+	}
+	return append(labels, names...)
+}
+
+func (r *Recorder) labelValues(info streamlister.RequestInfo, values ...string) []string {
+	labels := []string{info.Resource}
+	if r.namespaceLabel {
+		labels = append(labels, info.Namespace)
+	}
+	return append(labels, values...)
+}
+
+func (r *Recorder) ObserveTimeToFirstByte(info streamlister.RequestInfo, d time.Duration) {
+	r.timeToFirstByte.WithLabelValues(r.labelValues(info)...).Observe(d.Seconds())
+}
+
+func (r *Recorder) ObserveItemDecode(info streamlister.RequestInfo, encoding streamlister.Encoding, d time.Duration) {
+	r.itemDecode.WithLabelValues(r.labelValues(info, string(encoding))...).Observe(d.Seconds())
+}
+
+func (r *Recorder) ObserveRequest(info streamlister.RequestInfo, result streamlister.RequestResult) {
+	labels := r.labelValues(info, string(result.Encoding))
+	withOutcome := append(labels[:len(labels):len(labels)], string(result.Outcome))
+	r.requests.WithLabelValues(withOutcome...).Inc()
+	r.requestDuration.WithLabelValues(withOutcome...).Observe(result.Duration.Seconds())
+	r.transferredBytes.WithLabelValues(labels...).Add(float64(result.TransferredBytes))
+	r.decodedBytes.WithLabelValues(labels...).Add(float64(result.DecodedBytes))
+	r.items.WithLabelValues(labels...).Add(float64(result.Items))
+}
+
+func (r *Recorder) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		r.timeToFirstByte,
+		r.itemDecode,
+		r.requests,
+		r.requestDuration,
+		r.transferredBytes,
+		r.decodedBytes,
+		r.items,
+	}
+}
+
+func (r *Recorder) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range r.collectors() {
+		c.Describe(ch)
+	}
+}
+
+func (r *Recorder) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range r.collectors() {
+		c.Collect(ch)
+	}
+}
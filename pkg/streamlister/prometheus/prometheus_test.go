@@ -0,0 +1,52 @@
+package prometheus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ayanamist/k8s-utils/pkg/streamlister"
+)
+
+func TestRecorderLabels(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{name: "default", want: []string{"encoding", "outcome", "resource"}},
+		{name: "namespace label", opts: []Option{WithNamespaceLabel()}, want: []string{"encoding", "namespace", "outcome", "resource"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRecorder("test", tt.opts...)
+			registry := prometheus.NewPedanticRegistry()
+			registry.MustRegister(r)
+			info := streamlister.RequestInfo{Resource: "pods", Namespace: "default"}
+			r.ObserveTimeToFirstByte(info, time.Millisecond)
+			r.ObserveItemDecode(info, streamlister.EncodingProtobuf, time.Microsecond)
+			r.ObserveRequest(info, streamlister.RequestResult{Encoding: streamlister.EncodingProtobuf, Items: 3})
+
+			families, err := registry.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, family := range families {
+				if family.GetName() != "test_streamlister_requests_total" {
+					continue
+				}
+				var labels []string
+				for _, label := range family.GetMetric()[0].GetLabel() {
+					labels = append(labels, label.GetName())
+				}
+				if !reflect.DeepEqual(labels, tt.want) {
+					t.Errorf("labels got %v, want %v", labels, tt.want)
+				}
+				return
+			}
+			t.Fatal("requests_total not gathered")
+		})
+	}
+}
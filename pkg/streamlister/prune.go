@@ -0,0 +1,136 @@
+package streamlister
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/fieldpath"
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/protobuf"
+)
+
+// Presets for WithPruneFields.
+const (
+	PruneManagedFields = "metadata.managedFields"
+	PruneLastApplied   = "metadata.annotations[" + corev1.LastAppliedConfigAnnotation + "]"
+)
+
+// WithPruneFields drops the given JSON field paths from every item before OnObject, a single entry of a map
+// is addressed as "metadata.annotations[key]". With protobuf the fields are removed from the raw item,
+// so they are never allocated. With JSON they are cleared after decoding.
+func WithPruneFields(fieldPaths ...string) OptionFunc {
+	return func(options *streamListOptions) {
+		options.pruneFieldPaths = append(options.pruneFieldPaths, fieldPaths...)
+	}
+}
+
+type prunePath struct {
+	fieldpath.Path
+	mapKey string
+}
+
+type objectPruner struct {
+	paths []prunePath
+}
+
+// parsePrunePath splits "a.b[key]" into "a.b" and "key".
+func parsePrunePath(path string) (string, string, error) {
+	i := strings.IndexByte(path, '[')
+	if i < 0 {
+		return path, "", nil
+	}
+	if !strings.HasSuffix(path, "]") || i == len(path)-2 {
+		return "", "", fmt.Errorf("prune: invalid field path %q", path)
+	}
+	return path[:i], path[i+1 : len(path)-1], nil
+}
+
+// newObjectPruner resolves the field paths on the type of obj, returning nil if nothing is pruned.
+func newObjectPruner(obj runtime.Object, slo *streamListOptions) (*objectPruner, error) {
+	if len(slo.pruneFieldPaths) == 0 {
+		return nil, nil
+	}
+	_, isUnstructured := obj.(runtime.Unstructured)
+	pruner := &objectPruner{}
+	for _, path := range slo.pruneFieldPaths {
+		fields, mapKey, err := parsePrunePath(path)
+		if err != nil {
+			return nil, err
+		}
+		var p fieldpath.Path
+		if isUnstructured {
+			p = fieldpath.Path{JSON: strings.Split(fields, ".")}
+		} else {
+			p, err = fieldpath.Resolve(reflect.TypeOf(obj), fields)
+			if err != nil {
+				return nil, fmt.Errorf("prune: %w", err)
+			}
+			if mapKey != "" && (p.Type.Kind() != reflect.Map || p.Type.Key().Kind() != reflect.String) {
+				return nil, fmt.Errorf("prune: field path %q is %s, not a map", path, p.Type)
+			}
+		}
+		pruner.paths = append(pruner.paths, prunePath{Path: p, mapKey: mapKey})
+	}
+	return pruner, nil
+}
+
+func (p *objectPruner) protobufPruner() func(raw []byte) (int, error) {
+	paths := make([]protobuf.PrunePath, 0, len(p.paths))
+	for _, path := range p.paths {
+		paths = append(paths, protobuf.PrunePath{Fields: path.Proto, MapKey: path.mapKey})
+	}
+	return func(raw []byte) (int, error) {
+		return protobuf.PruneFields(raw, paths)
+	}
+}
+
+// prune clears the fields of a decoded object.
+func (p *objectPruner) prune(obj runtime.Object) {
+	if u, ok := obj.(runtime.Unstructured); ok {
+		content := u.UnstructuredContent()
+		for _, path := range p.paths {
+			if path.mapKey == "" {
+				unstructured.RemoveNestedField(content, path.JSON...)
+			} else if m, ok := nestedMap(content, path.JSON); ok {
+				delete(m, path.mapKey)
+			}
+		}
+		return
+	}
+	v := reflect.ValueOf(obj)
+	for _, path := range p.paths {
+		field, ok := path.Field(v)
+		if !ok {
+			continue
+		}
+		if path.mapKey == "" {
+			field.Set(reflect.Zero(field.Type()))
+		} else if !field.IsNil() {
+			field.SetMapIndex(reflect.ValueOf(path.mapKey).Convert(field.Type().Key()), reflect.Value{})
+		}
+	}
+}
+
+func nestedMap(content map[string]interface{}, fields []string) (map[string]interface{}, bool) {
+	v, found, _ := unstructured.NestedFieldNoCopy(content, fields...)
+	if !found {
+		return nil, false
+	}
+	m, ok := v.(map[string]interface{})
+	return m, ok
+}
+
+// pruneParam clears fields of decoded objects, it is used when the fields can not be removed before decoding.
+type pruneParam struct {
+	ParamWithErrorInterface
+	pruner *objectPruner
+}
+
+func (p *pruneParam) OnObject(obj runtime.Object) error {
+	p.pruner.prune(obj)
+	return p.ParamWithErrorInterface.OnObject(obj)
+}
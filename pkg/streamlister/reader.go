@@ -0,0 +1,89 @@
+package streamlister
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/types"
+)
+
+// StreamListFromReader decodes a list from r, e.g. a saved `kubectl get -o json` output or a captured apiserver
+// response. Protobuf or JSON is detected from the content, and gzip or zstd compressed content is decompressed.
+// Options about the request, like paging, resuming, encodings and metrics, are ignored.
+func StreamListFromReader(ctx context.Context, r io.Reader, param ParamInterface, opts ...OptionFunc) error {
+	return StreamListFromReaderWithError(ctx, r, types.WithError(param), opts...)
+}
+
+func StreamListFromReaderWithError(ctx context.Context, r io.Reader, param ParamWithErrorInterface, opts ...OptionFunc) error {
+	if err := streamListFromReader(ctx, r, param, opts...); err != nil {
+		if errors.Is(err, ErrStop) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func streamListFromReader(ctx context.Context, r io.Reader, param ParamWithErrorInterface, opts ...OptionFunc) (err error) {
+	slo, err := newOptions(opts, param)
+	if err != nil {
+		return err
+	}
+
+	ctx, span := slo.tracer().Start(ctx, "StreamListFromReader")
+	counted := &countingParam{ParamWithErrorInterface: param}
+	defer func() {
+		span.SetAttributes(counted.attributes()...)
+		endSpan(span, err)
+	}()
+
+	body, closeBody, err := decompress(contextReader{ctx: ctx, r: r}, "")
+	if err != nil {
+		return err
+	}
+	defer closeBody()
+	body, err = skipLeadingSpace(body)
+	if err != nil {
+		return err
+	}
+	encoding, err := decodeStream(body, "", counted, slo, newRequestObserver(nil, "", ""))
+	span.SetAttributes(encodingKey.String(string(encoding)))
+	if err != nil {
+		return err
+	}
+	return slo.integrity.finish(false)
+}
+
+// skipLeadingSpace drops whitespace before a JSON document, which files may start with.
+func skipLeadingSpace(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return br, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return br, br.UnreadByte()
+	}
+}
+
+// contextReader stops reading once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
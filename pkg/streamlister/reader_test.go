@@ -0,0 +1,125 @@
+package streamlister
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type readerResult struct {
+	typeMeta metav1.TypeMeta
+	listMeta metav1.ListMeta
+	pods     []*corev1.Pod
+}
+
+func streamPodsFromReader(ctx context.Context, r io.Reader) (*readerResult, error) {
+	result := &readerResult{}
+	err := StreamListFromReaderWithError(ctx, r, ParamWithErrorFuncs{
+		ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+		OnListMetaFunc: func(meta *metav1.ListMeta) error {
+			result.listMeta = *meta
+			return nil
+		},
+		OnTypeMetaFunc: func(meta *metav1.TypeMeta) error {
+			result.typeMeta = *meta
+			return nil
+		},
+		OnObjectFunc: func(o runtime.Object) error {
+			result.pods = append(result.pods, o.(*corev1.Pod))
+			return nil
+		},
+	})
+	return result, err
+}
+
+func TestStreamListFromReaderKubectlDump(t *testing.T) {
+	dump, err := ioutil.ReadFile("testdata/kubectl-get-pods.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"as saved":      dump,
+		"leading space": append([]byte("\n \t\r\n"), dump...),
+	} {
+		t.Run(name, func(t *testing.T) {
+			result, err := streamPodsFromReader(context.Background(), bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.typeMeta.APIVersion != "v1" || result.typeMeta.Kind != "List" {
+				t.Errorf("OnTypeMeta got %+v", result.typeMeta)
+			}
+			if len(result.pods) != 2 {
+				t.Fatalf("got %d pods", len(result.pods))
+			}
+			pod := result.pods[0]
+			if pod.Kind != "Pod" || pod.Namespace != "kube-system" || pod.Name != "coredns-74ff55c5b-8x2lq" {
+				t.Errorf("pod 0 got %s %s/%s", pod.Kind, pod.Namespace, pod.Name)
+			}
+			if memory := pod.Spec.Containers[0].Resources.Limits.Memory().String(); memory != "170Mi" {
+				t.Errorf("pod 0 memory limit got %s", memory)
+			}
+			if pod := result.pods[1]; pod.Name != "etcd-kind-control-plane" || !pod.Spec.HostNetwork || *pod.Spec.Priority != 2000001000 {
+				t.Errorf("pod 1 got %s hostNetwork=%v", pod.Name, pod.Spec.HostNetwork)
+			}
+		})
+	}
+}
+
+func TestStreamListFromReaderProtobufDump(t *testing.T) {
+	list := &corev1.PodList{
+		ListMeta: metav1.ListMeta{ResourceVersion: "7"},
+		Items: []corev1.Pod{
+			{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default"}},
+		},
+	}
+	result, err := streamPodsFromReader(context.Background(), bytes.NewReader(protobufPodList(t, list)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.typeMeta.APIVersion != "v1" || result.typeMeta.Kind != "PodList" {
+		t.Errorf("OnTypeMeta got %+v", result.typeMeta)
+	}
+	if result.listMeta.ResourceVersion != "7" {
+		t.Errorf("OnListMeta got %+v", result.listMeta)
+	}
+	if len(result.pods) != 2 || result.pods[0].Name != "a" || result.pods[1].Name != "b" {
+		t.Errorf("got %d pods", len(result.pods))
+	}
+}
+
+func TestStreamListFromReaderCancel(t *testing.T) {
+	jsonBody, protobufBody := podListBodies(t, 1000)
+	for name, data := range map[string][]byte{"json": jsonBody, "protobuf": protobufBody} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			body := &countingBody{r: bytes.NewReader(data)}
+			n := 0
+			err := StreamListFromReaderWithError(ctx, body, ParamWithErrorFuncs{
+				ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+				OnObjectFunc: func(runtime.Object) error {
+					n++
+					if n == 10 {
+						cancel()
+					}
+					return nil
+				},
+			})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("got %v, want context.Canceled", err)
+			}
+			if n >= 1000 || body.n >= len(data)/2 {
+				t.Errorf("got %d items and read %d of %d bytes after cancel", n, body.n, len(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package streamlister
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// A capture holds one record per response. A record is a JSON captureHeader line, the raw response body
+// as it was transferred in chunks each prefixed by its uvarint length, a zero length chunk, and
+// a JSON captureTrailer line. A record may be a gzip member on its own.
+const captureVersion = 1
+
+type captureHeader struct {
+	Version   int         `json:"version"`
+	Time      time.Time   `json:"time"`
+	Resource  string      `json:"resource,omitempty"`
+	Namespace string      `json:"namespace,omitempty"`
+	Header    http.Header `json:"header,omitempty"`
+}
+
+type captureTrailer struct {
+	Encoding Encoding `json:"encoding,omitempty"`
+	// Bytes is the length of the body read by the decoder, including what is not recorded.
+	Bytes     int64  `json:"bytes"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ErrCaptureTruncated is wrapped by the error of ReplayCapture if a record hit RecordOptions.MaxBytes.
+var ErrCaptureTruncated = errors.New("capture truncated")
+
+type RecordOptions struct {
+	// MaxBytes stops recording the body of a response after so many bytes, zero means no limit.
+	MaxBytes int64
+	// Gzip compresses every record.
+	Gzip bool
+}
+
+// WithRecord appends a record of every response to w while it is decoded, w must not be shared by
+// concurrent calls. Failing to write only stops recording. StreamListFanOut rejects it unless
+// WithFanOutConcurrency(1) is used, WithRecordDir works with any concurrency.
+func WithRecord(w io.Writer, opts RecordOptions) OptionFunc {
+	return func(options *streamListOptions) {
+		options.recordOptions = opts
+		options.sharedCapture = true
+		options.newCapture = func(RequestInfo) (io.WriteCloser, error) {
+			return nopWriteCloser{w}, nil
+		}
+	}
+}
+
+var captureSeq uint64
+
+// WithRecordDir writes a record of every response to a new file in dir.
+func WithRecordDir(dir string, opts RecordOptions) OptionFunc {
+	return func(options *streamListOptions) {
+		options.recordOptions = opts
+		options.sharedCapture = false
+		options.newCapture = func(info RequestInfo) (io.WriteCloser, error) {
+			name := fmt.Sprintf("%s-%s-%d.capture",
+				strings.ReplaceAll(info.Resource, "/", "_"), time.Now().Format("20060102T150405"), atomic.AddUint64(&captureSeq, 1))
+			if opts.Gzip {
+				name += ".gz"
+			}
+			return os.Create(filepath.Join(dir, name))
+		}
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// captureWriter records a single response.
+type captureWriter struct {
+	wc        io.WriteCloser
+	gz        *gzip.Writer
+	w         *bufio.Writer
+	maxBytes  int64
+	bytes     int64
+	truncated bool
+	err       error
+}
+
+// newCaptureWriter returns nil if the capture can not be created.
+func newCaptureWriter(slo *streamListOptions, info RequestInfo, header http.Header) *captureWriter {
+	wc, err := slo.newCapture(info)
+	if err != nil {
+		klog.ErrorS(err, "Failed to create StreamList capture", "resource", info.Resource)
+		return nil
+	}
+	c := &captureWriter{wc: wc, maxBytes: slo.recordOptions.MaxBytes}
+	var w io.Writer = wc
+	if slo.recordOptions.Gzip {
+		c.gz = gzip.NewWriter(wc)
+		w = c.gz
+	}
+	c.w = bufio.NewWriter(w)
+	c.writeLine(captureHeader{
+		Version:   captureVersion,
+		Time:      time.Now(),
+		Resource:  info.Resource,
+		Namespace: info.Namespace,
+		Header:    header,
+	})
+	return c
+}
+
+func (c *captureWriter) writeLine(v interface{}) {
+	if c.err != nil {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err == nil {
+		_, _ = c.w.Write(b)
+		err = c.w.WriteByte('\n')
+	}
+	c.fail(err)
+}
+
+func (c *captureWriter) fail(err error) {
+	if err != nil && c.err == nil {
+		c.err = err
+		klog.ErrorS(err, "Failed to write StreamList capture, recording stopped")
+	}
+}
+
+func (c *captureWriter) record(p []byte) {
+	c.bytes += int64(len(p))
+	if c.err != nil || c.truncated || len(p) == 0 {
+		return
+	}
+	if c.maxBytes > 0 {
+		recorded := c.bytes - int64(len(p))
+		if recorded+int64(len(p)) > c.maxBytes {
+			p = p[:c.maxBytes-recorded]
+			c.truncated = true
+		}
+		if len(p) == 0 {
+			return
+		}
+	}
+	var size [binary.MaxVarintLen64]byte
+	_, _ = c.w.Write(size[:binary.PutUvarint(size[:], uint64(len(p)))])
+	_, err := c.w.Write(p)
+	c.fail(err)
+}
+
+// finish writes the trailer, Bytes only counts what the decoder has read.
+func (c *captureWriter) finish(encoding Encoding, decodeErr error) {
+	if c.err == nil {
+		_ = c.w.WriteByte(0)
+	}
+	trailer := captureTrailer{Encoding: encoding, Bytes: c.bytes, Truncated: c.truncated}
+	if decodeErr != nil {
+		trailer.Error = decodeErr.Error()
+	}
+	c.writeLine(trailer)
+	if c.err == nil {
+		c.fail(c.w.Flush())
+	}
+	if c.gz != nil && c.err == nil {
+		c.fail(c.gz.Close())
+	}
+	c.fail(c.wc.Close())
+}
+
+// teeReader passes everything read to the capture.
+type teeReader struct {
+	r       io.Reader
+	capture *captureWriter
+}
+
+func (t teeReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.capture.record(p[:n])
+	return n, err
+}
+
+// ReplayCapture decodes every record of a capture written by WithRecord or WithRecordDir in order,
+// the same way as the recorded responses were decoded. Options about the request are ignored.
+func ReplayCapture(ctx context.Context, r io.Reader, param ParamWithErrorInterface, opts ...OptionFunc) error {
+	if err := replayCapture(ctx, r, param, opts...); err != nil {
+		if errors.Is(err, ErrStop) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func replayCapture(ctx context.Context, r io.Reader, param ParamWithErrorInterface, opts ...OptionFunc) error {
+	slo, err := newOptions(opts, param)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(contextReader{ctx: ctx, r: r})
+	if magic, _ := br.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		// Concatenated gzip members are read as a single stream.
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("gzip.NewReader: %w", err)
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
+	for i := 0; ; i++ {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return slo.integrity.finish(false)
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: read header: %w", i, err)
+		}
+		var header captureHeader
+		if err := json.Unmarshal(line, &header); err != nil {
+			return fmt.Errorf("record %d: decode header: %w", i, err)
+		}
+		if header.Version != captureVersion {
+			return fmt.Errorf("record %d: unsupported capture version %d", i, header.Version)
+		}
+		if err := replayRecord(br, header, param, slo); err != nil {
+			return fmt.Errorf("record %d: %w", i, err)
+		}
+	}
+}
+
+func replayRecord(br *bufio.Reader, header captureHeader, param ParamWithErrorInterface, slo *streamListOptions) error {
+	chunks := &chunkReader{r: br}
+	var decodeErr error
+	body, closeBody, err := decompress(chunks, header.Header.Get("Content-Encoding"))
+	if err != nil {
+		decodeErr = err
+	} else {
+		_, decodeErr = decodeStream(body, header.Header.Get("Content-Type"), param, slo, newRequestObserver(nil, header.Resource, header.Namespace))
+		closeBody()
+	}
+	if errors.Is(decodeErr, ErrStop) {
+		return decodeErr
+	}
+	// Skip what the decoder did not read to reach the trailer.
+	if _, err := io.Copy(ioutil.Discard, chunks); err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("read trailer: %w", err)
+	}
+	var trailer captureTrailer
+	if err := json.Unmarshal(line, &trailer); err != nil {
+		return fmt.Errorf("decode trailer: %w", err)
+	}
+	if decodeErr != nil && trailer.Truncated {
+		return fmt.Errorf("%w at %d of %d bytes: %v", ErrCaptureTruncated, chunks.n, trailer.Bytes, decodeErr)
+	}
+	return decodeErr
+}
+
+// chunkReader reads the body of a record, it returns io.EOF at the zero length chunk.
+type chunkReader struct {
+	r    *bufio.Reader
+	left uint64
+	eof  bool
+	n    int64
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if c.eof {
+		return 0, io.EOF
+	}
+	if c.left == 0 {
+		size, err := binary.ReadUvarint(c.r)
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		if size == 0 {
+			c.eof = true
+			return 0, io.EOF
+		}
+		c.left = size
+	}
+	if uint64(len(p)) > c.left {
+		p = p[:c.left]
+	}
+	n, err := c.r.Read(p)
+	c.left -= uint64(n)
+	c.n += int64(n)
+	if err != nil {
+		return n, unexpectedEOF(err)
+	}
+	return n, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
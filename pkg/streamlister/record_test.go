@@ -0,0 +1,154 @@
+package streamlister
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+// podsParam appends the names of the delivered pods to names.
+func podsParam(names *[]string) ParamWithErrorFuncs {
+	return ParamWithErrorFuncs{
+		ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+		OnObjectFunc: func(o runtime.Object) error {
+			*names = append(*names, o.(*corev1.Pod).Name)
+			return nil
+		},
+	}
+}
+
+func recordList(t *testing.T, handler http.Handler, opts ...OptionFunc) []string {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	client, err := NewRESTClient(&rest.Config{Host: srv.URL}, schema.GroupVersion{Version: "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	if err := StreamListWithError(context.Background(), client, "pods", "", metav1.ListOptions{}, podsParam(&names), opts...); err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+// protobufServer serves a protobuf PodList, compressed if contentEncoding is not empty.
+func protobufServer(t *testing.T, n int, contentEncoding string) http.Handler {
+	_, body := podListBodies(t, n)
+	if contentEncoding != "" {
+		body = compress(t, contentEncoding, body)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", runtime.ContentTypeProtobuf)
+		if contentEncoding != "" {
+			w.Header().Set("Content-Encoding", contentEncoding)
+		}
+		_, _ = w.Write(body)
+	})
+}
+
+func TestRecordReplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(t *testing.T) http.Handler
+		opts    []OptionFunc
+		record  RecordOptions
+	}{
+		{
+			name:    "json pages",
+			handler: func(t *testing.T) http.Handler { return &pagingServer{pods: podNames(50), pageSize: 20} },
+			opts:    []OptionFunc{WithPaging(20)},
+		},
+		{
+			name:    "gzip protobuf",
+			handler: func(t *testing.T) http.Handler { return protobufServer(t, 50, ContentEncodingGzip) },
+			opts:    []OptionFunc{WithContentEncodings(ContentEncodingGzip)},
+		},
+		{
+			name:    "json pages in gzip records",
+			handler: func(t *testing.T) http.Handler { return &pagingServer{pods: podNames(50), pageSize: 20} },
+			opts:    []OptionFunc{WithPaging(20)},
+			record:  RecordOptions{Gzip: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var capture bytes.Buffer
+			listed := recordList(t, tt.handler(t), append(tt.opts, WithRecord(&capture, tt.record))...)
+			if len(listed) != 50 {
+				t.Fatalf("listed %d items", len(listed))
+			}
+			if isGzip := bytes.HasPrefix(capture.Bytes(), gzipMagic); isGzip != tt.record.Gzip {
+				t.Errorf("capture is gzip compressed: %v", isGzip)
+			}
+
+			var replayed []string
+			if err := ReplayCapture(context.Background(), &capture, podsParam(&replayed)); err != nil {
+				t.Fatal(err)
+			}
+			checkNames(t, replayed, listed)
+		})
+	}
+}
+
+func TestRecordDirGzip(t *testing.T) {
+	dir := t.TempDir()
+	listed := recordList(t, &pagingServer{pods: podNames(50), pageSize: 20}, WithPaging(20), WithRecordDir(dir, RecordOptions{Gzip: true}))
+
+	files, err := filepath.Glob(filepath.Join(dir, "pods-*.capture.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("got capture files %v, want one per page", files)
+	}
+	var replayed []string
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(data, gzipMagic) {
+			t.Errorf("%s is not gzip compressed", file)
+		}
+		var names []string
+		if err := ReplayCapture(context.Background(), bytes.NewReader(data), podsParam(&names)); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		replayed = append(replayed, names...)
+	}
+	// File names sort by time and then sequence, which may not be the order of the pages.
+	sort.Strings(replayed)
+	checkNames(t, replayed, listed)
+}
+
+func TestRecordMaxBytes(t *testing.T) {
+	for _, gzip := range []bool{false, true} {
+		var capture bytes.Buffer
+		listed := recordList(t, protobufServer(t, 100, ""), WithRecord(&capture, RecordOptions{MaxBytes: 2000, Gzip: gzip}))
+		if len(listed) != 100 {
+			t.Fatalf("listed %d items", len(listed))
+		}
+
+		var replayed []string
+		err := ReplayCapture(context.Background(), &capture, podsParam(&replayed))
+		if !errors.Is(err, ErrCaptureTruncated) {
+			t.Fatalf("gzip=%v: got %v, want ErrCaptureTruncated", gzip, err)
+		}
+		if len(replayed) >= len(listed) {
+			t.Errorf("gzip=%v: replayed %d of %d items from a truncated capture", gzip, len(replayed), len(listed))
+		}
+		checkNames(t, replayed, listed[:len(replayed)])
+	}
+}
@@ -0,0 +1,131 @@
+package streamlister
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+)
+
+// Resolver finds the resource and the REST client to stream from a GroupVersionKind or a kubectl style name,
+// discovery results and REST clients are cached. A lookup without a match refreshes discovery once, so
+// resources added after the first lookup, e.g. new CRDs, are found.
+type Resolver struct {
+	config    *rest.Config
+	discovery *restmapper.DeferredDiscoveryRESTMapper
+	mapper    meta.RESTMapper
+
+	mu      sync.Mutex
+	clients map[schema.GroupVersion]rest.Interface
+}
+
+func NewResolver(config *rest.Config) (*Resolver, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("discovery.NewDiscoveryClientForConfig: %w", err)
+	}
+	return NewResolverForDiscovery(config, discoveryClient), nil
+}
+
+// NewResolverForDiscovery uses the given discovery client, e.g. the fake one from k8s.io/client-go/discovery/fake.
+func NewResolverForDiscovery(config *rest.Config, discoveryClient discovery.DiscoveryInterface) *Resolver {
+	cachedClient := memory.NewMemCacheClient(discoveryClient)
+	deferred := restmapper.NewDeferredDiscoveryRESTMapper(cachedClient)
+	return &Resolver{
+		config:    config,
+		discovery: deferred,
+		mapper:    restmapper.NewShortcutExpander(deferred, cachedClient),
+		clients:   make(map[schema.GroupVersion]rest.Interface),
+	}
+}
+
+// retryNoMatch calls f again after refreshing discovery if it fails to match.
+func (r *Resolver) retryNoMatch(f func() error) error {
+	err := f()
+	if meta.IsNoMatchError(err) {
+		r.discovery.Reset()
+		err = f()
+	}
+	return err
+}
+
+func (r *Resolver) MappingForKind(gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	var mapping *meta.RESTMapping
+	err := r.retryNoMatch(func() (err error) {
+		mapping, err = r.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mapper.RESTMapping %s: %w", gvk, err)
+	}
+	return mapping, nil
+}
+
+// MappingForName accepts the same resource names as kubectl, e.g. "po", "deployments.apps" or "deploy.v1.apps".
+func (r *Resolver) MappingForName(name string) (*meta.RESTMapping, error) {
+	fullySpecifiedGVR, groupResource := schema.ParseResourceArg(strings.ToLower(name))
+	var gvk schema.GroupVersionKind
+	err := r.retryNoMatch(func() (err error) {
+		if fullySpecifiedGVR != nil {
+			if gvk, err = r.mapper.KindFor(*fullySpecifiedGVR); err == nil {
+				return nil
+			}
+		}
+		gvk, err = r.mapper.KindFor(groupResource.WithVersion(""))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mapper.KindFor %s: %w", name, err)
+	}
+	return r.MappingForKind(gvk)
+}
+
+func (r *Resolver) Client(gv schema.GroupVersion) (rest.Interface, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if client, ok := r.clients[gv]; ok {
+		return client, nil
+	}
+	client, err := NewRESTClient(r.config, gv)
+	if err != nil {
+		return nil, err
+	}
+	r.clients[gv] = client
+	return client, nil
+}
+
+func (r *Resolver) StreamListKind(ctx context.Context, gvk schema.GroupVersionKind, namespace string, listOptions metav1.ListOptions, param ParamWithErrorInterface, opts ...OptionFunc) error {
+	mapping, err := r.MappingForKind(gvk)
+	if err != nil {
+		return err
+	}
+	return r.streamList(ctx, mapping, namespace, listOptions, param, opts...)
+}
+
+func (r *Resolver) StreamListName(ctx context.Context, name string, namespace string, listOptions metav1.ListOptions, param ParamWithErrorInterface, opts ...OptionFunc) error {
+	mapping, err := r.MappingForName(name)
+	if err != nil {
+		return err
+	}
+	return r.streamList(ctx, mapping, namespace, listOptions, param, opts...)
+}
+
+func (r *Resolver) streamList(ctx context.Context, mapping *meta.RESTMapping, namespace string, listOptions metav1.ListOptions, param ParamWithErrorInterface, opts ...OptionFunc) error {
+	if namespace != "" && mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return fmt.Errorf("resource %s is not namespaced", mapping.Resource)
+	}
+	client, err := r.Client(mapping.Resource.GroupVersion())
+	if err != nil {
+		return fmt.Errorf("NewRESTClient: %w", err)
+	}
+	opts = append([]OptionFunc{WithParameterCodec(metav1.ParameterCodec)}, opts...)
+	return StreamListWithError(ctx, client, mapping.Resource.Resource, namespace, listOptions, param, opts...)
+}
@@ -0,0 +1,125 @@
+package streamlister
+
+import (
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+var listVerbs = metav1.Verbs{"get", "list", "watch"}
+
+func fakeDiscovery() *fakediscovery.FakeDiscovery {
+	return &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", ShortNames: []string{"po"}, Kind: "Pod", Namespaced: true, Verbs: listVerbs},
+				{Name: "nodes", ShortNames: []string{"no"}, Kind: "Node", Verbs: listVerbs},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", ShortNames: []string{"deploy"}, Kind: "Deployment", Namespaced: true, Verbs: listVerbs},
+			},
+		},
+	}}}
+}
+
+func TestResolverMapping(t *testing.T) {
+	r := NewResolverForDiscovery(&rest.Config{}, fakeDiscovery())
+	tests := []struct {
+		name    string
+		mapping func() (*meta.RESTMapping, error)
+		want    schema.GroupVersionResource
+		scope   meta.RESTScopeName
+	}{
+		{
+			name: "kind",
+			mapping: func() (*meta.RESTMapping, error) {
+				return r.MappingForKind(schema.GroupVersionKind{Version: "v1", Kind: "Node"})
+			},
+			want:  schema.GroupVersionResource{Version: "v1", Resource: "nodes"},
+			scope: meta.RESTScopeNameRoot,
+		},
+		{
+			name:    "short name",
+			mapping: func() (*meta.RESTMapping, error) { return r.MappingForName("po") },
+			want:    schema.GroupVersionResource{Version: "v1", Resource: "pods"},
+			scope:   meta.RESTScopeNameNamespace,
+		},
+		{
+			name:    "short name with group",
+			mapping: func() (*meta.RESTMapping, error) { return r.MappingForName("deploy.apps") },
+			want:    schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+			scope:   meta.RESTScopeNameNamespace,
+		},
+		{
+			name:    "fully specified",
+			mapping: func() (*meta.RESTMapping, error) { return r.MappingForName("Deployments.v1.apps") },
+			want:    schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+			scope:   meta.RESTScopeNameNamespace,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping, err := tt.mapping()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mapping.Resource != tt.want || mapping.Scope.Name() != tt.scope {
+				t.Errorf("got %s scoped %s, want %s scoped %s", mapping.Resource, mapping.Scope.Name(), tt.want, tt.scope)
+			}
+		})
+	}
+}
+
+func TestResolverRefreshesDiscovery(t *testing.T) {
+	discovery := fakeDiscovery()
+	r := NewResolverForDiscovery(&rest.Config{}, discovery)
+	if _, err := r.MappingForName("pods"); err != nil {
+		t.Fatal(err)
+	}
+
+	crd := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	_, err := r.MappingForKind(crd)
+	var noKind *meta.NoKindMatchError
+	if !errors.As(err, &noKind) {
+		t.Fatalf("got %v before the CRD exists, want NoKindMatchError", err)
+	}
+
+	// The CRD is created after discovery was cached.
+	discovery.Resources = append(discovery.Resources, &metav1.APIResourceList{
+		GroupVersion: "example.com/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "widgets", ShortNames: []string{"wd"}, Kind: "Widget", Namespaced: true, Verbs: listVerbs},
+		},
+	})
+	mapping, err := r.MappingForKind(crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := crd.GroupVersion().WithResource("widgets"); mapping.Resource != want {
+		t.Errorf("got %s, want %s", mapping.Resource, want)
+	}
+
+	discovery.Resources = append(discovery.Resources, &metav1.APIResourceList{
+		GroupVersion: "example.com/v1beta1",
+		APIResources: []metav1.APIResource{
+			{Name: "gadgets", ShortNames: []string{"gd"}, Kind: "Gadget", Verbs: listVerbs},
+		},
+	})
+	mapping, err = r.MappingForName("gd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (schema.GroupVersionResource{Group: "example.com", Version: "v1beta1", Resource: "gadgets"}); mapping.Resource != want {
+		t.Errorf("got %s, want %s", mapping.Resource, want)
+	}
+}
@@ -0,0 +1,201 @@
+package streamlister
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/rest"
+)
+
+// WithResume makes StreamList resume a response body broken halfway from the last delivered item,
+// at most maxAttempts times. OnObject still sees each object exactly once. The same page is listed again,
+// with its continue token if there is one or else at the resource version of the broken response, and items
+// up to the last delivered one are skipped. This needs the list sorted by key like lists served from etcd,
+// the error is returned instead if it is not. Lists at resource version "0" are served unsorted from the
+// watch cache, so they fail with ErrInvalidOption before any request.
+func WithResume(maxAttempts int) OptionFunc {
+	return func(options *streamListOptions) {
+		options.resumeAttempts = maxAttempts
+	}
+}
+
+func WithOnResume(onResume func(attempt int, err error)) OptionFunc {
+	return func(options *streamListOptions) {
+		options.onResume = onResume
+	}
+}
+
+type bodyReadError struct {
+	err error
+}
+
+func (e *bodyReadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *bodyReadError) Unwrap() error {
+	return e.err
+}
+
+// bodyReader marks errors coming from the response body, so they can be told apart from decode errors.
+type bodyReader struct {
+	r io.Reader
+}
+
+func (b bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &bodyReadError{err: err}
+	}
+	return n, err
+}
+
+func isResumable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var bodyErr *bodyReadError
+	if errors.As(err, &bodyErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		utilnet.IsProbableEOF(err) ||
+		utilnet.IsConnectionReset(err) ||
+		utilnet.IsConnectionRefused(err)
+}
+
+// errResumeUnsorted is returned if a resumed list turns out not to be sorted by key,
+// items skipped as already delivered might then have been missed.
+var errResumeUnsorted = errors.New("resumed list is not sorted by key")
+
+type resumeParam struct {
+	ParamWithErrorInterface
+	namespace          string
+	forwardAllListMeta bool
+
+	resumed         bool
+	typeMetaSent    bool
+	resourceVersion string
+	// sorted is cleared once an item does not sort after the previous one of the same response.
+	sorted     bool
+	lastKey    string
+	delivered  int
+	attemptKey string
+}
+
+func (p *resumeParam) OnListMeta(meta *metav1.ListMeta) error {
+	if p.resourceVersion == "" {
+		p.resourceVersion = meta.ResourceVersion
+	}
+	if p.resumed && !p.forwardAllListMeta {
+		return nil
+	}
+	return p.ParamWithErrorInterface.OnListMeta(meta)
+}
+
+func (p *resumeParam) OnTypeMeta(meta *metav1.TypeMeta) error {
+	if p.typeMetaSent {
+		return nil
+	}
+	p.typeMetaSent = true
+	return p.ParamWithErrorInterface.OnTypeMeta(meta)
+}
+
+func (p *resumeParam) OnObject(o runtime.Object) error {
+	key, err := p.itemKey(o)
+	if err != nil {
+		return err
+	}
+	if p.attemptKey != "" && key <= p.attemptKey {
+		p.sorted = false
+		if p.resumed {
+			return errResumeUnsorted
+		}
+	}
+	p.attemptKey = key
+	if p.resumed && key <= p.lastKey {
+		return nil
+	}
+	if err := p.ParamWithErrorInterface.OnObject(o); err != nil {
+		return err
+	}
+	p.lastKey = key
+	p.delivered++
+	return nil
+}
+
+// itemKey returns the storage key of the object relative to the list prefix.
+func (p *resumeParam) itemKey(o runtime.Object) (string, error) {
+	accessor, err := meta.Accessor(o)
+	if err != nil {
+		return "", fmt.Errorf("meta.Accessor: %w", err)
+	}
+	if p.namespace == "" && accessor.GetNamespace() != "" {
+		return accessor.GetNamespace() + "/" + accessor.GetName(), nil
+	}
+	return accessor.GetName(), nil
+}
+
+// resumeOptions lists the same items again, those up to lastKey are skipped. This relies on lists served
+// from etcd being sorted by key, which is checked on every response.
+func (p *resumeParam) resumeOptions(listOptions metav1.ListOptions) (metav1.ListOptions, bool) {
+	if p.delivered == 0 {
+		return listOptions, true
+	}
+	if !p.sorted {
+		return listOptions, false
+	}
+	if listOptions.Continue != "" {
+		// The continue token issued by the server already pins the resource version.
+		return listOptions, true
+	}
+	if p.resourceVersion == "" {
+		return listOptions, false
+	}
+	next := listOptions
+	next.ResourceVersion = p.resourceVersion
+	next.ResourceVersionMatch = metav1.ResourceVersionMatchExact
+	return next, true
+}
+
+func streamListResumable(ctx context.Context, client rest.Interface, resource string, namespace string, listOptions metav1.ListOptions, param ParamWithErrorInterface, slo *streamListOptions) error {
+	if slo.resumeAttempts <= 0 {
+		return streamListOnce(ctx, client, resource, namespace, listOptions, param, slo)
+	}
+
+	rp := &resumeParam{
+		ParamWithErrorInterface: param,
+		namespace:               namespace,
+		forwardAllListMeta:      slo.paging,
+		sorted:                  true,
+	}
+	for attempt := 1; ; attempt++ {
+		rp.attemptKey = ""
+		err := streamListOnce(ctx, client, resource, namespace, listOptions, rp, slo)
+		if err == nil {
+			return nil
+		}
+		if attempt > slo.resumeAttempts || !isResumable(ctx, err) {
+			return err
+		}
+		if !slo.paging && listOptions.Limit > 0 && int64(rp.delivered) >= listOptions.Limit {
+			// The whole page is already delivered, only the trailing bytes are lost.
+			return nil
+		}
+		next, ok := rp.resumeOptions(listOptions)
+		if !ok {
+			return err
+		}
+		if onResume := slo.onResume; onResume != nil {
+			onResume(attempt, err)
+		}
+		rp.resumed = true
+		listOptions = next
+	}
+}
@@ -0,0 +1,171 @@
+package streamlister
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+// resumeServer serves pods as JSON and breaks the bodies of the requests selected by breakAt halfway.
+type resumeServer struct {
+	pods []string
+	// pageSize is used for requests with a limit, the continue token is the index of the next item.
+	pageSize int
+	breakAt  map[int]bool
+	// unsortedAt lists the requests which are served in reverse order.
+	unsortedAt map[int]bool
+
+	mu       sync.Mutex
+	requests []http.Request
+}
+
+func (s *resumeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	n := len(s.requests)
+	s.requests = append(s.requests, *r)
+	s.mu.Unlock()
+
+	query := r.URL.Query()
+	start, _ := strconv.Atoi(query.Get("continue"))
+	end := len(s.pods)
+	list := corev1.PodList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"}, ListMeta: metav1.ListMeta{ResourceVersion: "42"}}
+	if query.Get("limit") != "" && start+s.pageSize < end {
+		end = start + s.pageSize
+		list.Continue = strconv.Itoa(end)
+	}
+	for _, name := range s.pods[start:end] {
+		list.Items = append(list.Items, corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}})
+	}
+	if s.unsortedAt[n] {
+		for i, j := 0, len(list.Items)-1; i < j; i, j = i+1, j-1 {
+			list.Items[i], list.Items[j] = list.Items[j], list.Items[i]
+		}
+	}
+	body, _ := json.Marshal(&list)
+	w.Header().Set("Content-Type", runtime.ContentTypeJSON)
+	if !s.breakAt[n] {
+		_, _ = w.Write(body)
+		return
+	}
+	_, _ = w.Write(body[:len(body)/2])
+	w.(http.Flusher).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+func (s *resumeServer) query(i int, key string) string {
+	return s.requests[i].URL.Query().Get(key)
+}
+
+func podNames(n int) []string {
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		names = append(names, fmt.Sprintf("pod-%03d", i))
+	}
+	return names
+}
+
+func listResumable(t *testing.T, s *resumeServer, listOptions metav1.ListOptions, opts ...OptionFunc) ([]string, int, error) {
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	client, err := NewRESTClient(&rest.Config{Host: srv.URL}, schema.GroupVersion{Version: "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	resumes := 0
+	opts = append(opts, WithOnResume(func(int, error) { resumes++ }))
+	err = StreamListWithError(context.Background(), client, "pods", "", listOptions, ParamWithErrorFuncs{
+		ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+		OnObjectFunc: func(o runtime.Object) error {
+			names = append(names, o.(*corev1.Pod).Name)
+			return nil
+		},
+	}, opts...)
+	return names, resumes, err
+}
+
+func checkNames(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d items, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("item %d got %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestResumeAtResourceVersion(t *testing.T) {
+	s := &resumeServer{pods: podNames(50), breakAt: map[int]bool{0: true, 1: true}}
+	names, resumes, err := listResumable(t, s, metav1.ListOptions{}, WithResume(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkNames(t, names, s.pods)
+	if resumes != 2 || len(s.requests) != 3 {
+		t.Fatalf("got %d resumes and %d requests", resumes, len(s.requests))
+	}
+	for i := 1; i < 3; i++ {
+		if rv, match := s.query(i, "resourceVersion"), s.query(i, "resourceVersionMatch"); rv != "42" || match != string(metav1.ResourceVersionMatchExact) {
+			t.Errorf("request %d resourceVersion=%q resourceVersionMatch=%q", i, rv, match)
+		}
+		if s.query(i, "continue") != "" {
+			t.Errorf("request %d has a continue token", i)
+		}
+	}
+}
+
+func TestResumeWithContinueToken(t *testing.T) {
+	s := &resumeServer{pods: podNames(50), pageSize: 20, breakAt: map[int]bool{1: true}}
+	names, resumes, err := listResumable(t, s, metav1.ListOptions{}, WithPaging(20), WithResume(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkNames(t, names, s.pods)
+	if resumes != 1 || len(s.requests) != 4 {
+		t.Fatalf("got %d resumes and %d requests", resumes, len(s.requests))
+	}
+	if token := s.query(2, "continue"); token != "20" {
+		t.Errorf("resumed with continue token %q, want the one of the broken page", token)
+	}
+	if rv := s.query(2, "resourceVersion"); rv != "" {
+		t.Errorf("resumed with resourceVersion %q along with a continue token", rv)
+	}
+}
+
+func TestResumeUnsorted(t *testing.T) {
+	// The broken response is not sorted, so it can not be resumed.
+	s := &resumeServer{pods: podNames(50), breakAt: map[int]bool{0: true}, unsortedAt: map[int]bool{0: true}}
+	_, resumes, err := listResumable(t, s, metav1.ListOptions{}, WithResume(3))
+	if err == nil || resumes != 0 || len(s.requests) != 1 {
+		t.Fatalf("got err=%v after %d resumes and %d requests", err, resumes, len(s.requests))
+	}
+
+	// The resumed response is not sorted, items before the last delivered one might be missed.
+	s = &resumeServer{pods: podNames(50), breakAt: map[int]bool{0: true}, unsortedAt: map[int]bool{1: true}}
+	_, resumes, err = listResumable(t, s, metav1.ListOptions{}, WithResume(3))
+	if !errors.Is(err, errResumeUnsorted) || resumes != 1 {
+		t.Fatalf("got err=%v after %d resumes", err, resumes)
+	}
+}
+
+func TestResumeAtResourceVersionZero(t *testing.T) {
+	s := &resumeServer{pods: podNames(50)}
+	_, _, err := listResumable(t, s, metav1.ListOptions{ResourceVersion: "0"}, WithResume(3))
+	if !errors.Is(err, ErrInvalidOption) || len(s.requests) != 0 {
+		t.Fatalf("got err=%v after %d requests, want ErrInvalidOption before any request", err, len(s.requests))
+	}
+}
@@ -1,14 +1,16 @@
 package streamlister
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/naming"
@@ -16,8 +18,6 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/utils/trace"
 
-	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/json"
-	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/protobuf"
 	"github.com/ayanamist/k8s-utils/pkg/streamlister/internal/types"
 )
 
@@ -25,15 +25,109 @@ type ParamInterface = types.ParamInterface
 
 type ParamFuncs = types.ParamFuncs
 
+type ParamWithErrorInterface = types.ParamWithErrorInterface
+
+type ParamWithErrorFuncs = types.ParamWithErrorFuncs
+
+// ErrStop can be returned by any ParamWithErrorInterface callback to stop the stream early,
+// StreamListWithError will return nil in this case.
+var ErrStop = types.ErrStop
+
+var ErrProtobufUnsupported = errors.New("object does not implement proto.Unmarshaler")
+
+// ErrInvalidOption is wrapped by the error returned for an option with an invalid value, before any request.
+var ErrInvalidOption = errors.New("invalid option")
+
 type streamListOptions struct {
-	traceThreshold time.Duration
-	parameterCodec runtime.ParameterCodec
+	traceThreshold        time.Duration
+	parameterCodec        runtime.ParameterCodec
+	paging                bool
+	pageSize              int64
+	expiredContinuePolicy ExpiredContinuePolicy
+	resumeAttempts        int
+	onResume              func(attempt int, err error)
+	bufferSize            int
+	acceptContentTypes    []string
+	partialObjectMetadata bool
+	decodeWorkers         int
+	unorderedDelivery     bool
+	onUnknownField        func(message string, fieldNum int32, wireType int)
+	acceptEncodings       []string
+	metricsRecorder       MetricsRecorder
+	tracerProvider        oteltrace.TracerProvider
+	maxDecodeErrors       int
+	onDecodeError         func(index int, raw []byte, err error)
+	onItemError           func(index int, raw []byte, err error) error
+	filter                func(item *FilterItem) bool
+	filterFieldPaths      []string
+	pruneFieldPaths       []string
+	newCapture            func(info RequestInfo) (io.WriteCloser, error)
+	recordOptions         RecordOptions
+	sharedCapture         bool
+	limits                Limits
+	integrityCheck        bool
+	integrity             *integrityChecker
+	fanOutConcurrency     int
+	fanOutBestEffort      bool
+	objectType            reflect.Type
+	protobufSupported     bool
+	strictJSON            bool
+	onStrictError         func(index int, raw []byte, errs []error) error
+	// err is the first invalid option.
+	err error
 }
 
 func createDefaultOptions() *streamListOptions {
 	return &streamListOptions{
-		traceThreshold: 10 * time.Second,
-		parameterCodec: scheme.ParameterCodec,
+		traceThreshold:     10 * time.Second,
+		parameterCodec:     scheme.ParameterCodec,
+		acceptContentTypes: []string{runtime.ContentTypeProtobuf, runtime.ContentTypeJSON},
+	}
+}
+
+func (o *streamListOptions) unknownFieldHook(message string) func(fieldNum int32, wireType int) {
+	onUnknownField := o.onUnknownField
+	if onUnknownField == nil {
+		return nil
+	}
+	return func(fieldNum int32, wireType int) {
+		onUnknownField(message, fieldNum, wireType)
+	}
+}
+
+func (o *streamListOptions) acceptHeader() string {
+	if !o.partialObjectMetadata {
+		return strings.Join(o.acceptContentTypes, ",")
+	}
+	accepts := make([]string, 0, len(o.acceptContentTypes)+1)
+	for _, contentType := range o.acceptContentTypes {
+		accepts = append(accepts, contentType+";"+partialObjectMetadataListParams)
+	}
+	for _, contentType := range o.acceptContentTypes {
+		if contentType == runtime.ContentTypeJSON {
+			// Same as the metadata client, fall back to full objects if the server can not transform.
+			accepts = append(accepts, runtime.ContentTypeJSON)
+		}
+	}
+	return strings.Join(accepts, ",")
+}
+
+// setObjectType decides once per call whether items can be decoded from protobuf,
+// protobuf is not asked for if ObjectFactory does not support it and JSON is accepted.
+func (o *streamListOptions) setObjectType(obj runtime.Object) {
+	o.objectType = reflect.TypeOf(obj)
+	_, o.protobufSupported = obj.(proto.Unmarshaler)
+	if o.protobufSupported {
+		return
+	}
+	accepts := make([]string, 0, len(o.acceptContentTypes))
+	for _, contentType := range o.acceptContentTypes {
+		if contentType != runtime.ContentTypeProtobuf {
+			accepts = append(accepts, contentType)
+		}
+	}
+	if len(accepts) > 0 {
+		o.acceptContentTypes = accepts
 	}
 }
 
@@ -51,12 +145,100 @@ func WithParameterCodec(codec runtime.ParameterCodec) OptionFunc {
 	}
 }
 
+// WithParallelDecode unmarshals protobuf items with the given number of workers,
+// at most 2*workers items are held in memory while waiting for delivery.
+func WithParallelDecode(workers int) OptionFunc {
+	return func(options *streamListOptions) {
+		options.decodeWorkers = workers
+	}
+}
+
+// WithOnUnknownField reports protobuf fields of the list or its runtime.Unknown envelope which are not recognized,
+// message is either "List" or "Unknown". Such fields are always skipped.
+func WithOnUnknownField(onUnknownField func(message string, fieldNum int32, wireType int)) OptionFunc {
+	return func(options *streamListOptions) {
+		options.onUnknownField = onUnknownField
+	}
+}
+
+// WithUnorderedDelivery lets OnObject see items in the order they are decoded when WithParallelDecode is used.
+func WithUnorderedDelivery() OptionFunc {
+	return func(options *streamListOptions) {
+		options.unorderedDelivery = true
+	}
+}
+
 func StreamList(ctx context.Context, client rest.Interface, resource string, namespace string, listOptions metav1.ListOptions, param ParamInterface, opts ...OptionFunc) error {
+	return StreamListWithError(ctx, client, resource, namespace, listOptions, types.WithError(param), opts...)
+}
+
+func StreamListWithError(ctx context.Context, client rest.Interface, resource string, namespace string, listOptions metav1.ListOptions, param ParamWithErrorInterface, opts ...OptionFunc) error {
+	if err := streamList(ctx, client, resource, namespace, listOptions, param, opts...); err != nil {
+		if errors.Is(err, ErrStop) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// newOptions applies opts on the defaults, the result holds the state of a single StreamList call.
+// param may be nil if nothing is decoded with the options.
+func newOptions(opts []OptionFunc, param ParamWithErrorInterface) (*streamListOptions, error) {
 	slo := createDefaultOptions()
 	for _, opt := range opts {
 		opt(slo)
 	}
+	if slo.err != nil {
+		return nil, slo.err
+	}
+	if param != nil {
+		slo.setObjectType(param.ObjectFactory())
+	}
+	slo.onItemError = slo.itemErrorHook()
+	if slo.integrityCheck {
+		slo.integrity = &integrityChecker{}
+	}
+	return slo, nil
+}
+
+// invalid records the first option with an invalid value.
+func (o *streamListOptions) invalid(format string, args ...interface{}) {
+	if o.err == nil {
+		o.err = fmt.Errorf("%w: %s", ErrInvalidOption, fmt.Sprintf(format, args...))
+	}
+}
 
+func streamList(ctx context.Context, client rest.Interface, resource string, namespace string, listOptions metav1.ListOptions, param ParamWithErrorInterface, opts ...OptionFunc) (err error) {
+	slo, err := newOptions(opts, param)
+	if err != nil {
+		return err
+	}
+	if slo.resumeAttempts > 0 && listOptions.ResourceVersion == "0" {
+		return fmt.Errorf("%w: WithResume needs a list sorted by key, which resource version \"0\" does not guarantee",
+			ErrInvalidOption)
+	}
+
+	ctx, span := slo.tracer().Start(ctx, "StreamList", oteltrace.WithAttributes(requestAttributes(resource, namespace, listOptions)...))
+	counted := &countingParam{ParamWithErrorInterface: param}
+	param = counted
+	defer func() {
+		span.SetAttributes(counted.attributes()...)
+		endSpan(span, err)
+	}()
+
+	if slo.paging {
+		err = streamListPages(ctx, client, resource, namespace, listOptions, param, slo)
+	} else {
+		err = streamListResumable(ctx, client, resource, namespace, listOptions, param, slo)
+	}
+	if err != nil {
+		return err
+	}
+	return slo.integrity.finish(!slo.paging && listOptions.Limit > 0)
+}
+
+func streamListOnce(ctx context.Context, client rest.Interface, resource string, namespace string, listOptions metav1.ListOptions, param ParamWithErrorInterface, slo *streamListOptions) (err error) {
 	var timeout time.Duration
 	if listOptions.TimeoutSeconds != nil {
 		timeout = time.Duration(*listOptions.TimeoutSeconds) * time.Second
@@ -65,61 +247,75 @@ func StreamList(ctx context.Context, client rest.Interface, resource string, nam
 	initTrace := trace.New("StreamList", trace.Field{Key: "name", Value: naming.GetNameFromCallsite()})
 	defer initTrace.LogIfLong(slo.traceThreshold)
 
-	const acceptContentType = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
-	rc, err := client.Get().
+	observer := newRequestObserver(slo.metricsRecorder, resource, namespace)
+	counted := &countingParam{ParamWithErrorInterface: param}
+	param = counted
+	var result RequestResult
+	defer func() {
+		result.Items = counted.items
+		observer.finished(ctx, result, err)
+		if err != nil {
+			slo.integrity.interrupted()
+		}
+	}()
+
+	tracer := slo.tracer()
+	reqCtx, reqSpan := tracer.Start(ctx, "StreamList.request", oteltrace.WithAttributes(requestAttributes(resource, namespace, listOptions)...))
+
+	client, recorder := withResponseRecorder(client)
+	req := client.Get().
 		Namespace(namespace).
 		Resource(resource).
 		VersionedParams(&listOptions, slo.parameterCodec).
 		Timeout(timeout).
-		SetHeader("Accept", acceptContentType).
-		Stream(ctx)
+		SetHeader("Accept", slo.acceptHeader())
+	if len(slo.acceptEncodings) > 0 {
+		req = req.SetHeader("Accept-Encoding", slo.acceptEncodingHeader())
+	}
+	rc, err := req.Stream(reqCtx)
 
 	initTrace.Step("APIServer responded")
+	observer.responded()
+	endSpan(reqSpan, err)
 
 	if err != nil {
 		return fmt.Errorf("client.Stream: %w", err)
 	}
 	defer rc.Close()
-
-	var encoding string
-	defer initTrace.Step("Transfer and unmarshal finished: " + encoding)
-
-	prefix := make([]byte, 1)
-	if _, err := io.ReadFull(rc, prefix); err != nil {
-		return fmt.Errorf("rc.Read 1st byte: %w", err)
-	}
-	if firstByte := prefix[0]; firstByte == protobuf.EncodingPrefix[0] {
-		prefix := make([]byte, len(protobuf.EncodingPrefix)-1)
-		if _, err := io.ReadFull(rc, prefix); err != nil {
-			return fmt.Errorf("rc.Read: %w", err)
-		} else if !bytes.Equal(prefix, protobuf.EncodingPrefix[1:]) {
-			return errors.New("invalid protobuf encoding")
+	var raw io.Reader = bodyReader{r: rc}
+	if slo.newCapture != nil {
+		if capture := newCaptureWriter(slo, observer.info, recorder.responseHeader()); capture != nil {
+			raw = teeReader{r: raw, capture: capture}
+			defer func() {
+				capture.finish(result.Encoding, err)
+			}()
 		}
+	}
+	transferred := &countingReader{r: raw}
 
-		encoding = "protobuf"
-
-		o := param.ObjectFactory()
-		if _, ok := o.(proto.Unmarshaler); !ok {
-			return fmt.Errorf("object %T returned by ObjectFactory does not implement proto.Unmarshaler", o)
-		}
+	_, decodeSpan := tracer.Start(ctx, "StreamList.decode")
+	decoded := &countingReader{}
+	defer func() {
+		result.TransferredBytes = transferred.n
+		result.DecodedBytes = decoded.n
+		decodeSpan.SetAttributes(counted.attributes()...)
+		decodeSpan.SetAttributes(
+			encodingKey.String(string(result.Encoding)),
+			transferredBytesKey.Int64(transferred.n),
+			decodedBytesKey.Int64(decoded.n))
+		endSpan(decodeSpan, err)
+		initTrace.Step("Transfer and unmarshal finished: "+string(result.Encoding),
+			trace.Field{Key: "transferredBytes", Value: transferred.n},
+			trace.Field{Key: "decodedBytes", Value: decoded.n})
+	}()
 
-		if err := (protobuf.UnknownStreamUnmarshaler{
-			OnRaw: func(buffer *protobuf.StreamBuffer) error {
-				if err := protobuf.UnmarshalListStream(buffer, param); err != nil {
-					return fmt.Errorf("protobuf.UnmarshalListStream: %w", err)
-				}
-				return nil
-			},
-			OnTypeMeta: param.OnTypeMeta,
-		}).Unmarshal(protobuf.NewStreamBuffer(rc, -1)); err != nil {
-			return fmt.Errorf("protobuf.UnmarshalUnknown: %w", err)
-		}
-	} else if firstByte == '{' {
-		encoding = "json"
-		if err := json.StreamUnmarshaler(io.MultiReader(bytes.NewReader(prefix), rc), param); err != nil {
-			return fmt.Errorf("json.Unmarshal: %w", err)
-		}
+	body, closeBody, err := decompress(transferred, recorder.contentEncoding())
+	if err != nil {
+		return err
 	}
+	defer closeBody()
+	decoded.r = body
 
-	return nil
+	result.Encoding, err = decodeStream(decoded, recorder.contentType(), param, slo, observer)
+	return err
 }
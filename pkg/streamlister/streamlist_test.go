@@ -0,0 +1,160 @@
+package streamlister
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest/fake"
+)
+
+func protobufPodList(t *testing.T, list *corev1.PodList) []byte {
+	raw, err := list.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := runtime.Unknown{TypeMeta: runtime.TypeMeta{APIVersion: "v1", Kind: "PodList"}, Raw: raw}
+	body, err := unknown.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append([]byte("k8s\x00"), body...)
+}
+
+func fakeClient(contentType string, body []byte) *fake.RESTClient {
+	return &fake.RESTClient{
+		GroupVersion:         schema.GroupVersion{Version: "v1"},
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		Client: fake.CreateHTTPClient(func(*http.Request) (*http.Response, error) {
+			header := http.Header{}
+			header.Set("Content-Type", contentType)
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: ioutil.NopCloser(bytes.NewReader(body))}, nil
+		}),
+	}
+}
+
+func TestStreamListProtobufTypeMeta(t *testing.T) {
+	list := &corev1.PodList{
+		ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+		Items:    []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "a"}}},
+	}
+	client := fakeClient(runtime.ContentTypeProtobuf, protobufPodList(t, list))
+
+	var typeMeta metav1.TypeMeta
+	var names []string
+	err := StreamList(context.Background(), client, "pods", "", metav1.ListOptions{}, ParamFuncs{
+		ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+		OnTypeMetaFunc:    func(meta *metav1.TypeMeta) { typeMeta = *meta },
+		OnObjectFunc:      func(o runtime.Object) { names = append(names, o.(*corev1.Pod).Name) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"}); typeMeta != want {
+		t.Errorf("OnTypeMeta got %+v, want %+v", typeMeta, want)
+	}
+	if len(names) != 1 || names[0] != "a" {
+		t.Errorf("OnObject got %v", names)
+	}
+}
+
+// podListBodies returns the same PodList of n padded pods as a JSON and a protobuf response body.
+func podListBodies(t *testing.T, n int) (jsonBody, protobufBody []byte) {
+	list := &corev1.PodList{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"},
+		ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+	}
+	padding := strings.Repeat("x", 1024)
+	for i := 0; i < n; i++ {
+		list.Items = append(list.Items, corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("pod-%d", i),
+			Annotations: map[string]string{"padding": padding},
+		}})
+	}
+	jsonBody, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jsonBody, protobufPodList(t, list)
+}
+
+type countingBody struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func (c *countingBody) Close() error { return nil }
+
+func TestStreamListWithErrorStop(t *testing.T) {
+	jsonBody, protobufBody := podListBodies(t, 1000)
+	errCallback := errors.New("callback failed")
+	encodings := []struct {
+		name        string
+		contentType string
+		body        []byte
+	}{
+		{name: "json", contentType: runtime.ContentTypeJSON, body: jsonBody},
+		{name: "protobuf", contentType: runtime.ContentTypeProtobuf, body: protobufBody},
+	}
+	for _, enc := range encodings {
+		for _, callbackErr := range []error{ErrStop, errCallback} {
+			t.Run(fmt.Sprintf("%s/%v", enc.name, callbackErr), func(t *testing.T) {
+				body := &countingBody{r: bytes.NewReader(enc.body)}
+				client := &fake.RESTClient{
+					GroupVersion:         schema.GroupVersion{Version: "v1"},
+					NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+					Client: fake.CreateHTTPClient(func(*http.Request) (*http.Response, error) {
+						header := http.Header{}
+						header.Set("Content-Type", enc.contentType)
+						return &http.Response{StatusCode: http.StatusOK, Header: header, Body: body}, nil
+					}),
+				}
+
+				var names []string
+				err := StreamListWithError(context.Background(), client, "pods", "", metav1.ListOptions{}, ParamWithErrorFuncs{
+					ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+					OnObjectFunc: func(o runtime.Object) error {
+						names = append(names, o.(*corev1.Pod).Name)
+						if len(names) == 10 {
+							return callbackErr
+						}
+						return nil
+					},
+				})
+				if callbackErr == ErrStop {
+					if err != nil {
+						t.Fatalf("got %v, want nil", err)
+					}
+				} else {
+					if !errors.Is(err, errCallback) || err == errCallback {
+						t.Fatalf("got %v, want it wrapping %v", err, errCallback)
+					}
+				}
+				if len(names) != 10 {
+					t.Errorf("OnObject called %d times after returning %v, want 10", len(names), callbackErr)
+				}
+				if body.n >= len(enc.body)/2 {
+					t.Errorf("read %d of %d bytes after the callback returned %v", body.n, len(enc.body), callbackErr)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package streamlister
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StrictDecodingError is returned by WithStrictJSON without a callback for the first item with unknown
+// or duplicate fields.
+type StrictDecodingError struct {
+	// Index is the position of the item in its response.
+	Index  int
+	Errors []error
+}
+
+func (e *StrictDecodingError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("strict decoding of item at index %d: %s", e.Index, strings.Join(msgs, ", "))
+}
+
+// WithStrictJSON reports unknown and duplicate fields of JSON items to onStrictError, the item is still delivered
+// if it returns nil. The list fails with StrictDecodingError if onStrictError is nil. raw is only valid during
+// the call. Protobuf responses are not affected, JSON items are read into memory before decoding.
+func WithStrictJSON(onStrictError func(index int, raw []byte, errs []error) error) OptionFunc {
+	return func(options *streamListOptions) {
+		options.strictJSON = true
+		options.onStrictError = onStrictError
+	}
+}
+
+// strictErrorHook returns nil if strict decoding is not enabled.
+func (o *streamListOptions) strictErrorHook() func(index int, raw []byte, errs []error) error {
+	if !o.strictJSON {
+		return nil
+	}
+	if o.onStrictError != nil {
+		return o.onStrictError
+	}
+	return func(index int, raw []byte, errs []error) error {
+		return &StrictDecodingError{Index: index, Errors: errs}
+	}
+}
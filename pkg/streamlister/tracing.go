@@ -0,0 +1,87 @@
+package streamlister
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const tracerName = "github.com/ayanamist/k8s-utils/pkg/streamlister"
+
+var (
+	resourceKey         = attribute.Key("k8s.resource")
+	namespaceKey        = attribute.Key("k8s.namespace")
+	resourceVersionKey  = attribute.Key("k8s.resource_version")
+	continueKey         = attribute.Key("k8s.continue")
+	listResourceVersion = attribute.Key("streamlister.list.resource_version")
+	itemsKey            = attribute.Key("streamlister.items")
+	encodingKey         = attribute.Key("streamlister.encoding")
+	transferredBytesKey = attribute.Key("streamlister.transferred_bytes")
+	decodedBytesKey     = attribute.Key("streamlister.decoded_bytes")
+)
+
+// WithTracerProvider creates OpenTelemetry spans from the given provider instead of the global one.
+// The k8s.io/utils/trace log of slow lists is kept either way.
+func WithTracerProvider(provider oteltrace.TracerProvider) OptionFunc {
+	return func(options *streamListOptions) {
+		options.tracerProvider = provider
+	}
+}
+
+func (o *streamListOptions) tracer() oteltrace.Tracer {
+	provider := o.tracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+func requestAttributes(resource, namespace string, listOptions metav1.ListOptions) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		resourceKey.String(resource),
+		namespaceKey.String(namespace),
+		resourceVersionKey.String(listOptions.ResourceVersion),
+	}
+	if listOptions.Continue != "" {
+		attrs = append(attrs, continueKey.Bool(true))
+	}
+	return attrs
+}
+
+// endSpan records err unless it is ErrStop, which is not a failure.
+func endSpan(span oteltrace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrStop) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// countingParam counts delivered items and keeps the resourceVersion of the list.
+type countingParam struct {
+	ParamWithErrorInterface
+	items           int
+	resourceVersion string
+}
+
+func (p *countingParam) OnListMeta(listMeta *metav1.ListMeta) error {
+	p.resourceVersion = listMeta.ResourceVersion
+	return p.ParamWithErrorInterface.OnListMeta(listMeta)
+}
+
+func (p *countingParam) OnObject(obj runtime.Object) error {
+	p.items++
+	return p.ParamWithErrorInterface.OnObject(obj)
+}
+
+func (p *countingParam) attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		itemsKey.Int(p.items),
+		listResourceVersion.String(p.resourceVersion),
+	}
+}
@@ -0,0 +1,117 @@
+package streamlister
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+func traceList(t *testing.T, handler http.Handler, opts ...OptionFunc) ([]sdktrace.ReadOnlySpan, error) {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	client, err := NewRESTClient(&rest.Config{Host: srv.URL}, schema.GroupVersion{Version: "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	err = StreamListWithError(context.Background(), client, "pods", "default", metav1.ListOptions{}, ParamWithErrorFuncs{
+		ObjectFactoryFunc: func() runtime.Object { return &corev1.Pod{} },
+		OnObjectFunc:      func(runtime.Object) error { return nil },
+	}, append(opts, WithTracerProvider(provider))...)
+	return recorder.Ended(), err
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func checkSpanAttributes(t *testing.T, span sdktrace.ReadOnlySpan, want ...attribute.KeyValue) {
+	t.Helper()
+	attrs := spanAttributes(span)
+	for _, kv := range want {
+		if got, ok := attrs[kv.Key]; !ok || got != kv.Value {
+			t.Errorf("%s %s got %q, want %q", span.Name(), kv.Key, got.Emit(), kv.Value.Emit())
+		}
+	}
+}
+
+func TestStreamListSpans(t *testing.T) {
+	s := &pagingServer{pods: podNames(50), pageSize: 20}
+	spans, err := traceList(t, s, WithPaging(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 7 {
+		t.Fatalf("got %d spans, want StreamList with a request and a decode span per page", len(spans))
+	}
+	// The StreamList span ends after the spans of every request.
+	root := spans[len(spans)-1]
+	if root.Name() != "StreamList" || root.Parent().IsValid() {
+		t.Fatalf("last span got %s with parent %v", root.Name(), root.Parent())
+	}
+	checkSpanAttributes(t, root,
+		resourceKey.String("pods"),
+		namespaceKey.String("default"),
+		itemsKey.Int(50),
+		listResourceVersion.String("42"))
+	if root.Status().Code == codes.Error {
+		t.Errorf("StreamList status got %+v", root.Status())
+	}
+
+	wantItems := []int{20, 20, 10}
+	for page := 0; page < 3; page++ {
+		request, decode := spans[2*page], spans[2*page+1]
+		if request.Name() != "StreamList.request" || decode.Name() != "StreamList.decode" {
+			t.Fatalf("page %d spans got %s and %s", page, request.Name(), decode.Name())
+		}
+		for _, span := range []sdktrace.ReadOnlySpan{request, decode} {
+			if span.Parent().SpanID() != root.SpanContext().SpanID() {
+				t.Errorf("page %d %s is not a child of StreamList", page, span.Name())
+			}
+		}
+		if _, ok := spanAttributes(request)[continueKey]; ok != (page > 0) {
+			t.Errorf("page %d request has %s: %v", page, continueKey, ok)
+		}
+		checkSpanAttributes(t, request, resourceKey.String("pods"), namespaceKey.String("default"))
+		checkSpanAttributes(t, decode,
+			encodingKey.String(string(EncodingJSON)),
+			itemsKey.Int(wantItems[page]),
+			listResourceVersion.String("42"))
+		if bytes := spanAttributes(decode)[transferredBytesKey].AsInt64(); bytes <= 0 {
+			t.Errorf("page %d decode %s got %d", page, transferredBytesKey, bytes)
+		}
+	}
+}
+
+func TestStreamListSpansError(t *testing.T) {
+	spans, err := traceList(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	if len(spans) != 2 || spans[0].Name() != "StreamList.request" || spans[1].Name() != "StreamList" {
+		t.Fatalf("got %d spans, want the failed request and StreamList", len(spans))
+	}
+	for _, span := range spans {
+		if span.Status().Code != codes.Error {
+			t.Errorf("%s status got %+v", span.Name(), span.Status())
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package streamlister
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+)
+
+type TypedParamFuncs[T any] struct {
+	OnListMetaFunc func(*metav1.ListMeta) error
+	OnTypeMetaFunc func(*metav1.TypeMeta) error
+	OnObjectFunc   func(*T) error
+}
+
+type objectPointer[T any] interface {
+	*T
+	runtime.Object
+}
+
+// StreamListTyped is StreamListWithError for a concrete object type, e.g.
+//
+//	StreamListTyped[corev1.Pod](ctx, client, "pods", "", metav1.ListOptions{}, TypedParamFuncs[corev1.Pod]{
+//		OnObjectFunc: func(pod *corev1.Pod) error { return nil },
+//	})
+//
+// Items keep the TypeMeta they were sent with, which is usually empty. OnTypeMeta reports the list TypeMeta,
+// for JSON it may only be called after the items if kind follows them. Types without protobuf support are
+// requested as JSON only.
+func StreamListTyped[T any, PT objectPointer[T]](ctx context.Context, client rest.Interface, resource string, namespace string, listOptions metav1.ListOptions, param TypedParamFuncs[T], opts ...OptionFunc) error {
+	return StreamListWithError(ctx, client, resource, namespace, listOptions, typedParam[T, PT](param), opts...)
+}
+
+func typedParam[T any, PT objectPointer[T]](param TypedParamFuncs[T]) ParamWithErrorFuncs {
+	return ParamWithErrorFuncs{
+		ObjectFactoryFunc: func() runtime.Object {
+			return PT(new(T))
+		},
+		OnListMetaFunc: param.OnListMetaFunc,
+		OnTypeMetaFunc: param.OnTypeMetaFunc,
+		OnObjectFunc: func(o runtime.Object) error {
+			return param.OnObjectFunc(o.(PT))
+		},
+	}
+}
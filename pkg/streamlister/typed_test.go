@@ -0,0 +1,63 @@
+package streamlister
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest/fake"
+)
+
+// jsonOnlyPod has no protobuf methods, like most hand-written CRD types.
+type jsonOnlyPod struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		NodeName string `json:"nodeName,omitempty"`
+	} `json:"spec,omitempty"`
+}
+
+func (p *jsonOnlyPod) DeepCopyObject() runtime.Object {
+	c := *p
+	p.ObjectMeta.DeepCopyInto(&c.ObjectMeta)
+	return &c
+}
+
+func TestStreamListTypedJSONOnly(t *testing.T) {
+	var accepts []string
+	client := &fake.RESTClient{
+		GroupVersion:         schema.GroupVersion{Version: "v1"},
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			accepts = append(accepts, req.Header.Get("Accept"))
+			header := http.Header{}
+			header.Set("Content-Type", runtime.ContentTypeJSON)
+			body := []byte(`{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"1"},"items":[` +
+				`{"metadata":{"name":"a"},"spec":{"nodeName":"node-1"}},{"metadata":{"name":"b"}}]}`)
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: ioutil.NopCloser(bytes.NewReader(body))}, nil
+		}),
+	}
+
+	var got []string
+	err := StreamListTyped[jsonOnlyPod](context.Background(), client, "pods", "", metav1.ListOptions{}, TypedParamFuncs[jsonOnlyPod]{
+		OnObjectFunc: func(pod *jsonOnlyPod) error {
+			got = append(got, pod.Name+"/"+pod.Spec.NodeName)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accepts) != 1 || accepts[0] != runtime.ContentTypeJSON {
+		t.Errorf("Accept got %q, want %q", accepts, runtime.ContentTypeJSON)
+	}
+	if len(got) != 2 || got[0] != "a/node-1" || got[1] != "b/" {
+		t.Errorf("OnObject got %q", got)
+	}
+}